@@ -0,0 +1,194 @@
+// Copyright 2018 Andrew Werner, All Rights Reserved.
+
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// numericAlignWindow is the number of recent values whose widths determine
+// the alignment of numeric values.
+const numericAlignWindow = 100
+
+// numericAligner pads numbers so that they line up at their decimal points,
+// or at their right edges if they are integers, with the numbers which came
+// shortly before them. Only the most recent values are considered so that a
+// single wide value does not widen the column for the rest of a stream.
+type numericAligner struct {
+	// widths holds the widths of the integer and fractional parts of the
+	// recent values in a ring.
+	widths [][2]int
+	next   int
+}
+
+func newNumericAligner() *numericAligner {
+	return &numericAligner{}
+}
+
+// align returns the padded value. Values which are not numbers are returned
+// unchanged.
+func (a *numericAligner) align(v string) string {
+	if _, err := strconv.ParseFloat(v, 64); err != nil {
+		return v
+	}
+	intPart, frac := v, ""
+	if i := strings.IndexByte(v, '.'); i >= 0 {
+		intPart, frac = v[:i], v[i:]
+	}
+	w := [2]int{len(intPart), len(frac)}
+	if len(a.widths) < numericAlignWindow {
+		a.widths = append(a.widths, w)
+	} else {
+		a.widths[a.next] = w
+		a.next = (a.next + 1) % numericAlignWindow
+	}
+	var max [2]int
+	for _, w := range a.widths {
+		for i := range w {
+			if w[i] > max[i] {
+				max[i] = w[i]
+			}
+		}
+	}
+	return strings.Repeat(" ", max[0]-len(intPart)) + v + strings.Repeat(" ", max[1]-len(frac))
+}
+
+// padSpec pads the value of a capture group to a fixed width.
+type padSpec struct {
+	group    string
+	width    int
+	truncate bool
+}
+
+// parsePadSpec parses a specification of the form group=N[,truncate].
+func parsePadSpec(spec string) (padSpec, error) {
+	var p padSpec
+	s := spec
+	if strings.HasSuffix(s, ",truncate") {
+		s, p.truncate = strings.TrimSuffix(s, ",truncate"), true
+	}
+	i := strings.LastIndexByte(s, '=')
+	if i <= 0 {
+		return p, fmt.Errorf("invalid pad %q, expected group=N[,truncate]", spec)
+	}
+	width, err := strconv.Atoi(s[i+1:])
+	if err != nil || width <= 0 {
+		return p, fmt.Errorf("invalid pad %q: width must be a positive integer", spec)
+	}
+	p.group, p.width = s[:i], width
+	return p, nil
+}
+
+// pad returns v padded with spaces to the width, which is measured in terminal
+// columns ignoring escape sequences. Longer values are truncated if truncate
+// is set, and padded again if a wide rune did not fit, and are otherwise
+// returned unchanged.
+func (p padSpec) pad(v string) string {
+	w := visibleWidth(v)
+	if w > p.width && p.truncate {
+		v = truncateVisible(v, p.width)
+		w = visibleWidth(v)
+	}
+	if w < p.width {
+		return v + strings.Repeat(" ", p.width-w)
+	}
+	return v
+}
+
+// visibleWidth returns the number of terminal columns occupied by s, ignoring
+// escape sequences.
+func visibleWidth(s string) int {
+	n := 0
+	for i := 0; i < len(s); {
+		if s[i] == '\x1b' {
+			i += escapeLen(s[i:])
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(s[i:])
+		i += size
+		n += runeWidth(r)
+	}
+	return n
+}
+
+// wideRanges are the ranges of the common East Asian wide and fullwidth runes
+// and emoji, which occupy two columns.
+var wideRanges = &unicode.RangeTable{
+	R16: []unicode.Range16{
+		{0x1100, 0x115f, 1},
+		{0x2e80, 0x303e, 1},
+		{0x3041, 0x33ff, 1},
+		{0x3400, 0x4dbf, 1},
+		{0x4e00, 0x9fff, 1},
+		{0xa000, 0xa4cf, 1},
+		{0xac00, 0xd7a3, 1},
+		{0xf900, 0xfaff, 1},
+		{0xfe30, 0xfe4f, 1},
+		{0xff00, 0xff60, 1},
+		{0xffe0, 0xffe6, 1},
+	},
+	R32: []unicode.Range32{
+		{0x1f300, 0x1f64f, 1},
+		{0x1f900, 0x1f9ff, 1},
+		{0x20000, 0x3fffd, 1},
+	},
+}
+
+// runeWidth returns the number of columns occupied by r: none for combining
+// marks, control and format characters, two for wide runes and otherwise one.
+func runeWidth(r rune) int {
+	switch {
+	case unicode.In(r, unicode.Mn, unicode.Me, unicode.Cc, unicode.Cf):
+		return 0
+	case unicode.Is(wideRanges, r):
+		return 2
+	default:
+		return 1
+	}
+}
+
+// truncateVisible returns the prefix of s which fits in width columns,
+// keeping any escape sequences which follow it.
+func truncateVisible(s string, width int) string {
+	var buf strings.Builder
+	n := 0
+	for i := 0; i < len(s); {
+		if s[i] == '\x1b' {
+			e := escapeLen(s[i:])
+			buf.WriteString(s[i : i+e])
+			i += e
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if n += runeWidth(r); n <= width {
+			buf.WriteString(s[i : i+size])
+		}
+		i += size
+	}
+	return buf.String()
+}
+
+// padFlag is a flag.Value which accumulates a padSpec for each use of the
+// flag.
+type padFlag []padSpec
+
+func (f *padFlag) String() string {
+	specs := make([]string, len(*f))
+	for i, p := range *f {
+		specs[i] = fmt.Sprintf("%s=%d", p.group, p.width)
+	}
+	return strings.Join(specs, " ")
+}
+
+func (f *padFlag) Set(spec string) error {
+	p, err := parsePadSpec(spec)
+	if err != nil {
+		return err
+	}
+	*f = append(*f, p)
+	return nil
+}
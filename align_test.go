@@ -0,0 +1,101 @@
+// Copyright 2018 Andrew Werner, All Rights Reserved.
+
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestParsePadSpec(t *testing.T) {
+	for _, c := range []struct {
+		spec string
+		exp  padSpec
+		err  bool
+	}{
+		{spec: "prefix=10", exp: padSpec{group: "prefix", width: 10}},
+		{spec: "a=b=3,truncate", exp: padSpec{group: "a=b", width: 3, truncate: true}},
+		{spec: "prefix", err: true},
+		{spec: "=3", err: true},
+		{spec: "prefix=0", err: true},
+		{spec: "prefix=x", err: true},
+	} {
+		p, err := parsePadSpec(c.spec)
+		if (err != nil) != c.err {
+			t.Errorf("parsePadSpec(%q): unexpected error %v", c.spec, err)
+		} else if err == nil && p != c.exp {
+			t.Errorf("parsePadSpec(%q) = %+v, expected %+v", c.spec, p, c.exp)
+		}
+	}
+}
+
+func TestPad(t *testing.T) {
+	red := "\x1b[38;2;255;0;0m"
+	reset := "\x1b[39m"
+	for _, c := range []struct {
+		name     string
+		v        string
+		width    int
+		truncate bool
+		exp      string
+	}{
+		{"ascii", "ab", 4, false, "ab  "},
+		{"exact", "abcd", 4, false, "abcd"},
+		{"longer is kept", "abcdef", 4, false, "abcdef"},
+		{"longer is truncated", "abcdef", 4, true, "abcd"},
+		{"accented", "héllo", 7, false, "héllo  "},
+		{"combining mark", "he\u0301llo", 7, false, "he\u0301llo  "},
+		{"cjk", "日本", 6, false, "日本  "},
+		{"cjk truncated", "日本語", 4, true, "日本"},
+		{"cjk truncated within a rune", "日本語", 5, true, "日本 "},
+		{"emoji", "🔥ok", 5, false, "🔥ok "},
+		{"colored", red + "日本" + reset, 5, false, red + "日本" + reset + " "},
+		{"colored truncated", red + "日本語" + reset, 3, true, red + "日" + reset + " "},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			p := padSpec{group: "g", width: c.width, truncate: c.truncate}
+			if got := p.pad(c.v); got != c.exp {
+				t.Fatalf("pad(%q) = %q, expected %q", c.v, got, c.exp)
+			}
+		})
+	}
+}
+
+func TestVisibleWidth(t *testing.T) {
+	for _, c := range []struct {
+		s   string
+		exp int
+	}{
+		{"", 0},
+		{"abc", 3},
+		{"\x1b[38;2;1;2;3mabc\x1b[39m", 3},
+		{"\x1b[1;7mx\x1b[22;27m", 1},
+		{"héllo", 5},
+		{"he\u0301llo", 5},
+		{"a\u20dd", 1},
+		{"日本語", 6},
+		{"\x1b[1m日本\x1b[0m語", 6},
+		{"한국어", 6},
+		{"ｆｕｌｌ", 8},
+		{"🔥", 2},
+		{"a\u200bb", 2},
+	} {
+		if got := visibleWidth(c.s); got != c.exp {
+			t.Errorf("visibleWidth(%q) = %d, expected %d", c.s, got, c.exp)
+		}
+	}
+}
+
+func TestVisibleLenTemplate(t *testing.T) {
+	tmpl, err := newTemplate(`{{ visiblelen .Header }}`, newColorMap(), newColorMap().getColor, nil, nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, LogEntry{Entry: Entry{Header: "\x1b[1m日本\x1b[0mé"}}); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != "5" {
+		t.Errorf("visiblelen = %s, expected 5", buf.String())
+	}
+}
@@ -0,0 +1,76 @@
+// Copyright 2018 Andrew Werner, All Rights Reserved.
+
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/lucasb-eyer/go-colorful"
+	"github.com/wayneashleyberry/truecolor/pkg/color"
+)
+
+// category gives entries matching a regexp a fixed color.
+type category struct {
+	re    *regexp.Regexp
+	color *color.Message
+	spec  string
+}
+
+// parseCategory parses a category of the form REGEXP=#rrggbb. The regexp may
+// itself contain = as the color follows the last one.
+func parseCategory(spec string) (category, error) {
+	i := strings.LastIndexByte(spec, '=')
+	if i < 0 {
+		return category{}, fmt.Errorf("invalid category %q, expected regexp=#rrggbb", spec)
+	}
+	re, err := regexp.Compile(spec[:i])
+	if err != nil {
+		return category{}, fmt.Errorf("invalid category %q: %v", spec, err)
+	}
+	c, err := colorful.Hex(spec[i+1:])
+	if err != nil {
+		return category{}, fmt.Errorf("invalid category %q: %v", spec, err)
+	}
+	return category{re: re, color: color.Color(c.RGB255()), spec: spec}, nil
+}
+
+// categoryFlag is a flag.Value which accumulates categories in the order in
+// which they are given. The first category which matches an entry applies.
+type categoryFlag []category
+
+func (f *categoryFlag) String() string {
+	specs := make([]string, len(*f))
+	for i, c := range *f {
+		specs[i] = c.spec
+	}
+	return strings.Join(specs, " ")
+}
+
+func (f *categoryFlag) Set(spec string) error {
+	c, err := parseCategory(spec)
+	if err != nil {
+		return err
+	}
+	*f = append(*f, c)
+	return nil
+}
+
+// match returns the color of the first category which matches text.
+func (f categoryFlag) match(text string) (*color.Message, bool) {
+	if c, ok := f.find(text); ok {
+		return c.color, true
+	}
+	return nil, false
+}
+
+// find returns the first category which matches text.
+func (f categoryFlag) find(text string) (*category, bool) {
+	for i := range f {
+		if f[i].re.MatchString(text) {
+			return &f[i], true
+		}
+	}
+	return nil, false
+}
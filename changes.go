@@ -0,0 +1,41 @@
+// Copyright 2018 Andrew Werner, All Rights Reserved.
+
+package main
+
+import "strings"
+
+// SGR escape sequences which highlight changed values in reverse video.
+const (
+	sgrReverse   = "\x1b[7m"
+	sgrNoReverse = "\x1b[27m"
+)
+
+// changeHighlighter highlights the values of capture groups which differ from
+// their values in the previous entry.
+type changeHighlighter struct {
+	groups []string
+	prev   map[string]string
+}
+
+func newChangeHighlighter(groups string) *changeHighlighter {
+	return &changeHighlighter{
+		groups: strings.Split(groups, ","),
+		prev:   map[string]string{},
+	}
+}
+
+// highlight wraps the values of the watched groups of the entry which changed
+// since the previous entry in which they participated.
+func (h *changeHighlighter) highlight(le *LogEntry) {
+	for _, g := range h.groups {
+		idx, ok := le.findSubexp(g)
+		if !ok || le.matches == nil || le.matches[2*idx] < 0 {
+			continue
+		}
+		v, _ := le.Match(g)
+		if prev, seen := h.prev[g]; seen && prev != v {
+			le.replaceSubexp(idx, sgrReverse+v+sgrNoReverse)
+		}
+		h.prev[g] = v
+	}
+}
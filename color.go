@@ -0,0 +1,587 @@
+// Copyright 2018 Andrew Werner, All Rights Reserved.
+
+package main
+
+import (
+	"crypto/md5"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/lucasb-eyer/go-colorful"
+	"github.com/wayneashleyberry/truecolor/pkg/color"
+)
+
+// colorMap assigns a stable color to each key it is asked about.
+type colorMap struct {
+	colors map[string]*color.Message
+
+	// pinTop, if positive, is the number of most frequently seen keys which
+	// are given their vivid colors. All other keys are given muted colors.
+	// counts holds the number of entries of each key passed to count, and
+	// pinned the pinTop keys with the most.
+	pinTop int
+	counts map[string]int
+	pinned map[string]bool
+	muted  map[string]*color.Message
+
+	// intensityByLevel causes getLevelColor to scale the chroma of a key's
+	// color by the severity of the entry being colored.
+	intensityByLevel bool
+	// dimBelow causes getLevelColor to darken the colors of levels below it.
+	dimBelow    level
+	levelColors map[levelKey]*color.Message
+
+	// keyLength, if non-zero, is the number of runes of a key which determine
+	// its color. Keys are truncated to a prefix of that length, or to a suffix
+	// if it is negative, before they are hashed.
+	keyLength int
+
+	// ring, if set, restricts keys to its fixed set of colors.
+	ring *colorRing
+	// stableIndex causes keys to be given colors of the 256 color palette
+	// chosen directly by their hash. See stableIndexRGB.
+	stableIndex bool
+
+	// seed is prepended to keys before they are hashed, so that changing it
+	// reshuffles the colors of all keys.
+	seed string
+
+	// chroma and lightness are the ranges from which the chroma and
+	// lightness of the colors of keys are chosen.
+	chroma, lightness hclRange
+
+	// hueDrift, if positive, is the period over which the hues of all keys
+	// rotate once around the wheel, measured from start. See drift.
+	hueDrift time.Duration
+	start    time.Time
+
+	// values holds the color given to each key, for -dump-color-map.
+	values map[string]colorful.Color
+	// loaded holds the colors read by -load-color-map, which take precedence
+	// over the colors keys would otherwise be given.
+	loaded map[string]colorful.Color
+}
+
+type levelKey struct {
+	key   string
+	level level
+}
+
+func newColorMap() *colorMap {
+	return &colorMap{
+		colors: map[string]*color.Message{},
+		counts: map[string]int{},
+		pinned: map[string]bool{},
+		muted:  map[string]*color.Message{},
+		values: map[string]colorful.Color{},
+
+		chroma:    defaultChroma,
+		lightness: defaultLightness,
+
+		levelColors: map[levelKey]*color.Message{},
+	}
+}
+
+// withSettings returns a new colorMap with the settings of m but none of the
+// colors or counts it has accumulated.
+func (m *colorMap) withSettings() *colorMap {
+	c := newColorMap()
+	c.pinTop = m.pinTop
+	c.intensityByLevel = m.intensityByLevel
+	c.dimBelow = m.dimBelow
+	c.keyLength = m.keyLength
+	c.seed = m.seed
+	c.ring = m.ring
+	c.stableIndex = m.stableIndex
+	c.loaded = m.loaded
+	c.chroma, c.lightness = m.chroma, m.lightness
+	c.hueDrift, c.start = m.hueDrift, m.start
+	return c
+}
+
+// noColor disables colors entirely. It is set in main when the NO_COLOR
+// environment variable is present.
+var noColor bool
+
+// plainColor formats text without escape sequences.
+var plainColor = &color.Message{}
+
+// neutralColor is used for the empty key, which is given to entries that have
+// nothing to be colored by.
+var neutralColor = color.Color(0x9e, 0x9e, 0x9e)
+
+func (m *colorMap) getColor(s string) *color.Message {
+	if noColor {
+		return plainColor
+	}
+	if s == "" {
+		return neutralColor
+	}
+	m.record(s)
+	if m.pinTop > 0 && !m.isPinned(s) {
+		return m.getMutedColor(s)
+	}
+	if m.hueDrift > 0 {
+		h, c, l := m.keyHCL(s)
+		return color.Color(colorful.Hcl(m.drift(h), c, l).Clamped().RGB255())
+	}
+	if col, ok := m.colors[s]; ok {
+		return col
+	}
+	col := color.Color(m.values[s].RGB255())
+	m.colors[s] = col
+	return col
+}
+
+// record notes the color of the key s, which is being colored, in values.
+// Every path by which keys are colored calls it, so that values holds every
+// key colored so far.
+func (m *colorMap) record(s string) {
+	if _, ok := m.values[s]; !ok {
+		m.values[s] = m.keyColor(s)
+	}
+}
+
+// keyColor returns the color of the non-empty key s.
+func (m *colorMap) keyColor(s string) colorful.Color {
+	if c, ok := m.loaded[s]; ok {
+		return c
+	}
+	if m.stableIndex {
+		r, g, b := stableIndexRGB(m.hashInput(s))
+		return colorful.Color{R: float64(r) / 255, G: float64(g) / 255, B: float64(b) / 255}
+	}
+	h, c, l := m.keyHCL(s)
+	return colorful.Hcl(h, c, l).Clamped()
+}
+
+// background returns body on a background of the color of the key s. Only the
+// background is reset after body, so that it may contain colored text.
+func (m *colorMap) background(s, body string) string {
+	if noColor || body == "" {
+		return body
+	}
+	r, g, b := uint8(0x9e), uint8(0x9e), uint8(0x9e)
+	if s != "" {
+		r, g, b = m.keyColor(s).RGB255()
+	}
+	return wrapSGR(body, fmt.Sprintf("\x1b[48;2;%d;%d;%dm", r, g, b), sgrDefaultBackground)
+}
+
+// legend writes each key m has colored, in order, beside a swatch of its
+// color.
+func (m *colorMap) legend(w io.Writer) {
+	keys := make([]string, 0, len(m.values))
+	for k := range m.values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		col, ok := m.colors[k]
+		if muted, isMuted := m.muted[k]; isMuted && !m.isPinned(k) {
+			col, ok = muted, true
+		}
+		if !ok {
+			col = color.Color(m.values[k].RGB255())
+		}
+		fmt.Fprintf(w, "%s %s\n", col.Sprint("██"), strings.Replace(k, tenantSeparator, "/", 1))
+	}
+}
+
+// levelChroma scales the chroma of a color by the severity of the entry.
+var levelChroma = map[level]float64{
+	traceLevel:   .3,
+	debugLevel:   .5,
+	infoLevel:    1,
+	warningLevel: 1.3,
+	errorLevel:   1.6,
+	fatalLevel:   2,
+}
+
+// getLevelColor is like getColor, but adjusts the color for the level of the
+// entry being colored. If intensityByLevel is set the color is made more vivid
+// for severe levels and more muted for verbose ones. As chroma rather than
+// lightness is scaled, the colors of all levels remain legible on a dark
+// background. If dimBelow is set, levels below it are darkened.
+func (m *colorMap) getLevelColor(s string, l level) *color.Message {
+	if noColor {
+		return plainColor
+	}
+	_, ok := levelChroma[l]
+	intense := m.intensityByLevel && ok
+	dim := m.dimmed(l)
+	if s == "" || (!intense && !dim) {
+		return m.getColor(s)
+	}
+	m.record(s)
+	if m.pinTop > 0 && !m.isPinned(s) {
+		return m.getMutedColor(s)
+	}
+	if m.hueDrift > 0 {
+		h, c, lum := m.levelHCL(s, l)
+		return color.Color(colorful.Hcl(m.drift(h), c, lum).Clamped().RGB255())
+	}
+	k := levelKey{key: s, level: l}
+	if col, ok := m.levelColors[k]; ok {
+		return col
+	}
+	col := color.Color(colorful.Hcl(m.levelHCL(s, l)).Clamped().RGB255())
+	m.levelColors[k] = col
+	return col
+}
+
+// levelHCL returns the color of the key s adjusted for the level l as
+// described by getLevelColor.
+func (m *colorMap) levelHCL(s string, l level) (h, c, lum float64) {
+	h, c, lum = m.keyHCL(s)
+	if scale, ok := levelChroma[l]; ok && m.intensityByLevel {
+		c *= scale
+		if l < infoLevel {
+			lum *= .85
+		}
+	}
+	if m.dimmed(l) {
+		lum *= .6
+	}
+	return h, c, lum
+}
+
+// drift rotates the hue h by the whole number of degrees which the -hue-drift
+// period has turned since start, so that entries written later are given
+// slightly different shades of the colors of their keys than earlier ones.
+// As the rotation follows the clock rather than the input, the same input is
+// colored differently each time it is processed, and keys whose hues are
+// close may be confused with a drifted neighbor over a long enough run.
+func (m *colorMap) drift(h float64) float64 {
+	turned := math.Floor(360 * float64(time.Since(m.start)) / float64(m.hueDrift))
+	return math.Mod(h+turned, 360)
+}
+
+// dimmed returns true if entries of level l should be darkened.
+func (m *colorMap) dimmed(l level) bool {
+	return l != unknownLevel && l < m.dimBelow
+}
+
+// getMutedColor returns a color with the hue of s but with so little chroma
+// that muted colors are nearly indistinguishable from one another.
+func (m *colorMap) getMutedColor(s string) *color.Message {
+	if col, ok := m.muted[s]; ok {
+		return col
+	}
+	h, _, _ := m.keyHCL(s)
+	col := color.Color(colorful.Hcl(h, .05, .55).Clamped().RGB255())
+	m.muted[s] = col
+	return col
+}
+
+// count records an entry whose color key is s for -pin-top. Once pinTop keys
+// are pinned, a key displaces the pinned key with the fewest entries only when
+// it has more, so that the pinned keys do not flicker between keys which are
+// equally frequent.
+func (m *colorMap) count(s string) {
+	if m.pinTop <= 0 || s == "" {
+		return
+	}
+	m.counts[s]++
+	if m.pinned[s] {
+		return
+	}
+	if len(m.pinned) < m.pinTop {
+		m.pinned[s] = true
+		return
+	}
+	var least string
+	for k := range m.pinned {
+		if least == "" || m.counts[k] < m.counts[least] ||
+			(m.counts[k] == m.counts[least] && k > least) {
+			least = k
+		}
+	}
+	if m.counts[s] > m.counts[least] {
+		delete(m.pinned, least)
+		m.pinned[s] = true
+	}
+}
+
+// isPinned returns true if s is among the pinTop keys with the most entries.
+// Keys which are not the color keys of entries, such as the keys of
+// expandjson, are never counted and are always given their vivid colors.
+func (m *colorMap) isPinned(s string) bool {
+	return m.pinned[s] || m.counts[s] == 0
+}
+
+// hashInput returns the string whose hash determines the color of s, which is
+// the part of s which determines its color prefixed with the seed.
+func (m *colorMap) hashInput(s string) string {
+	return m.seed + m.truncateKey(s)
+}
+
+// truncateKey returns the part of s which determines its color.
+func (m *colorMap) truncateKey(s string) string {
+	if m.keyLength == 0 {
+		return s
+	}
+	r, n := []rune(s), m.keyLength
+	switch {
+	case n > 0 && n < len(r):
+		return string(r[:n])
+	case n < 0 && -n < len(r):
+		return string(r[len(r)+n:])
+	}
+	return s
+}
+
+// keyHCL returns the color of the key s.
+func (m *colorMap) keyHCL(s string) (h, c, l float64) {
+	if v, ok := m.loaded[s]; ok {
+		return v.Hcl()
+	}
+	if m.ring != nil {
+		return m.ring.hue(m.hashInput(s)), m.chroma.mid(), m.lightness.mid()
+	}
+	if tenant, key, ok := splitTenantKey(s); ok {
+		return m.tenantHCL(tenant, key)
+	}
+	return hcl(m.hashInput(s), m.chroma, m.lightness)
+}
+
+// tenantSeparator separates the tenant of -hue-from from the rest of a key.
+const tenantSeparator = "\x00"
+
+// hueSectors is the number of sectors into which -hue-from divides the hue
+// wheel.
+const hueSectors = 8
+
+// tenantKey returns the key under which key is colored for tenant.
+func tenantKey(tenant, key string) string {
+	return tenant + tenantSeparator + key
+}
+
+// splitTenantKey splits a key returned by tenantKey.
+func splitTenantKey(s string) (tenant, key string, ok bool) {
+	i := strings.Index(s, tenantSeparator)
+	if i < 0 {
+		return "", s, false
+	}
+	return s[:i], s[i+len(tenantSeparator):], true
+}
+
+// tenantHCL returns the color of key within tenant. The hue wheel is divided
+// into hueSectors equal sectors, and the hash of the tenant chooses its
+// sector, so that tenants in distinct sectors never share a hue however their
+// keys are named. The hash of the key chooses its hue within the middle 80%
+// of the sector, leaving a gap between neighboring tenants, and its chroma and
+// lightness as usual. As there are few sectors, some tenants share one.
+func (m *colorMap) tenantHCL(tenant, key string) (h, c, l float64) {
+	th, _, _ := hcl(m.seed+tenant, m.chroma, m.lightness)
+	kh, c, l := hcl(m.hashInput(key), m.chroma, m.lightness)
+	width := 360.0 / hueSectors
+	return (math.Floor(th/width) + .1 + .8*kh/360) * width, c, l
+}
+
+// shortID returns a short identifier for the key s derived from the same hash
+// which determines its color.
+func (m *colorMap) shortID(s string) string {
+	sum := keyHash(m.hashInput(s))
+	return hex.EncodeToString(sum[:3])
+}
+
+func keyHash(s string) [md5.Size]byte {
+	return md5.Sum([]byte(s))
+}
+
+// hclRange is a range of chroma or lightness.
+type hclRange struct {
+	min, max float64
+}
+
+// The default ranges of chroma and lightness, which give colors legible on a
+// dark background.
+var (
+	defaultChroma    = hclRange{.33, .53}
+	defaultLightness = hclRange{.6, .9}
+)
+
+// at returns the value at the fraction f of the way through the range.
+func (r hclRange) at(f float64) float64 { return r.min + (r.max-r.min)*f }
+
+func (r hclRange) mid() float64 { return r.at(.5) }
+
+// validate returns an error if the range is empty or extends beyond [0, 1].
+func (r hclRange) validate(name string) error {
+	if r.min < 0 || r.max > 1 || r.min > r.max {
+		return fmt.Errorf("-%s-min and -%s-max must satisfy 0 <= min <= max <= 1", name, name)
+	}
+	return nil
+}
+
+// hcl derives a hue, and a chroma and lightness within the given ranges, from
+// the md5 sum of s.
+func hcl(s string, chroma, lightness hclRange) (h, c, l float64) {
+	sum := keyHash(s)
+	f1 := float64(binary.BigEndian.Uint64(sum[8:])) / math.MaxUint64
+	f2 := float64(binary.BigEndian.Uint64(sum[:8])) / math.MaxUint64
+	f3 := float64(binary.LittleEndian.Uint64(sum[4:])) / math.MaxUint64
+	h = 360 * f1
+	c = chroma.at(f2)
+	l = lightness.at(f3)
+	return h, c, l
+}
+
+var statusColors = map[byte]*color.Message{
+	'1': color.Color(0x9e, 0x9e, 0x9e),
+	'2': color.Color(0x4c, 0xaf, 0x50),
+	'3': color.Color(0x26, 0xc6, 0xda),
+	'4': color.Color(0xff, 0xca, 0x28),
+	'5': color.Color(0xef, 0x53, 0x50),
+}
+
+// statusColor returns a fixed color for the class of an HTTP status code.
+// Escape sequences in status, such as those of -highlight-changes, are
+// ignored.
+func statusColor(status string) *color.Message {
+	if noColor {
+		return plainColor
+	}
+	if status = stripEscapes(status); len(status) == 3 {
+		if col, ok := statusColors[status[0]]; ok {
+			return col
+		}
+	}
+	return neutralColor
+}
+
+var severityColors = map[string]*color.Message{
+	"I": color.Color(0x26, 0xc6, 0xda),
+	"W": color.Color(0xff, 0xca, 0x28),
+	"E": color.Color(0xef, 0x53, 0x50),
+	"F": color.Color(0xff, 0x17, 0x44).Bold(),
+}
+
+// severityColor returns a template function which returns a fixed color for
+// the single character severities I, W, E and F. Other severities are given
+// the color returned by getColor.
+func severityColor(getColor func(string) *color.Message) func(string) *color.Message {
+	return func(s string) *color.Message {
+		if noColor {
+			return plainColor
+		}
+		if col, ok := severityColors[stripEscapes(s)]; ok {
+			return col
+		}
+		return getColor(s)
+	}
+}
+
+var colorNames = [...]string{
+	"aardvark", "badger", "beaver", "bison", "bobcat", "camel", "cheetah", "cobra",
+	"condor", "coyote", "crane", "dingo", "dolphin", "eagle", "elk", "falcon",
+	"ferret", "finch", "fox", "gazelle", "gecko", "gibbon", "gopher", "heron",
+	"hyena", "ibis", "iguana", "jackal", "jaguar", "koala", "lemur", "leopard",
+	"llama", "lynx", "magpie", "marmot", "marten", "mink", "moose", "newt",
+	"ocelot", "orca", "osprey", "otter", "panda", "pelican", "puffin", "quail",
+	"rabbit", "raven", "salmon", "seal", "shrew", "sloth", "stork", "tapir",
+	"tiger", "toucan", "turtle", "viper", "walrus", "weasel", "wombat", "yak",
+}
+
+// colorName returns a name for the key s chosen by the same hash as its
+// color, so that -color-seed and -color-key-length apply to names as they do
+// to colors.
+func (m *colorMap) colorName(s string) string {
+	if s == "" {
+		return ""
+	}
+	sum := keyHash(m.hashInput(s))
+	return colorNames[binary.BigEndian.Uint64(sum[:8])%uint64(len(colorNames))]
+}
+
+// defaultLevelColors are the background colors of level chips.
+const defaultLevelColors = "T=#616161,D=#546e7a,I=#1565c0,W=#f9a825,E=#c62828,F=#ad1457"
+
+// parseLevelColors parses a comma-separated list of level=#rrggbb pairs.
+func parseLevelColors(spec string) (map[level]colorful.Color, error) {
+	colors := map[level]colorful.Color{}
+	for _, kv := range strings.Split(spec, ",") {
+		i := strings.IndexByte(kv, '=')
+		if i < 0 {
+			return nil, fmt.Errorf("invalid level color %q, expected level=#rrggbb", kv)
+		}
+		l := parseLevel(kv[:i])
+		if l == unknownLevel {
+			return nil, fmt.Errorf("invalid level color %q: unknown level %q", kv, kv[:i])
+		}
+		c, err := colorful.Hex(kv[i+1:])
+		if err != nil {
+			return nil, fmt.Errorf("invalid level color %q: %v", kv, err)
+		}
+		colors[l] = c
+	}
+	return colors, nil
+}
+
+// levelChip returns a template function which renders a severity as a chip of
+// text on a background of the color of its level. The text is black or white,
+// whichever stands out more against the background. Severities of unknown
+// levels are returned unchanged.
+func levelChip(colors map[level]colorful.Color) func(string) string {
+	return func(s string) string {
+		bg, ok := colors[parseLevel(s)]
+		if !ok || noColor {
+			return s
+		}
+		fg := "255;255;255"
+		if _, _, l := bg.Hcl(); l > .65 {
+			fg = "0;0;0"
+		}
+		r, g, b := bg.RGB255()
+		return fmt.Sprintf("\x1b[48;2;%d;%d;%dm\x1b[38;2;%sm %s \x1b[39;49m", r, g, b, fg, s)
+	}
+}
+
+// SGR escape sequences which are applied to text directly.
+const (
+	sgrBold              = "\x1b[1m"
+	sgrDim               = "\x1b[2m"
+	sgrNormalIntensity   = "\x1b[22m"
+	sgrDefaultBackground = "\x1b[49m"
+	sgrUnderline         = "\x1b[4m"
+	sgrNoUnderline       = "\x1b[24m"
+)
+
+// bold renders s in bold unless color is disabled. Only the intensity is
+// reset after s, so that bold text may be nested within colored text.
+func bold(s string) string {
+	if noColor || s == "" {
+		return s
+	}
+	return wrapSGR(s, sgrBold, sgrNormalIntensity)
+}
+
+// dim is like bold but renders s dimmed.
+func dim(s string) string {
+	if noColor || s == "" {
+		return s
+	}
+	return wrapSGR(s, sgrDim, sgrNormalIntensity)
+}
+
+// underline is like bold but underlines s. Only underlining is reset after s.
+func underline(s string) string {
+	if noColor || s == "" {
+		return s
+	}
+	return wrapSGR(s, sgrUnderline, sgrNoUnderline)
+}
+
+// wrapSGR surrounds s with the escape sequences start and end, leaving any
+// trailing newlines outside of them.
+func wrapSGR(s, start, end string) string {
+	body := strings.TrimRight(s, "\n")
+	return start + body + end + s[len(body):]
+}
@@ -0,0 +1,166 @@
+// Copyright 2018 Andrew Werner, All Rights Reserved.
+
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+
+	"github.com/lucasb-eyer/go-colorful"
+)
+
+// cubeLevels are the intensities of each channel of the 6x6x6 color cube of
+// the 256 color palette, which occupies indices 16 through 231.
+var cubeLevels = [6]int{0, 95, 135, 175, 215, 255}
+
+// nearestCubeLevel returns the index of the cube level nearest to v.
+func nearestCubeLevel(v int) int {
+	best := 0
+	for i, l := range cubeLevels {
+		if abs(l-v) < abs(cubeLevels[best]-v) {
+			best = i
+		}
+	}
+	return best
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+// to256 returns the index of the color of the 256 color palette nearest to
+// the given color, choosing from the color cube and the grayscale ramp at
+// indices 232 through 255.
+func to256(r, g, b int) int {
+	ri, gi, bi := nearestCubeLevel(r), nearestCubeLevel(g), nearestCubeLevel(b)
+	cr, cg, cb := cubeLevels[ri], cubeLevels[gi], cubeLevels[bi]
+	cubeDist := sq(r-cr) + sq(g-cg) + sq(b-cb)
+	gray := (r + g + b) / 3
+	step := (gray - 8) / 10
+	if step < 0 {
+		step = 0
+	} else if step > 23 {
+		step = 23
+	}
+	gv := 8 + 10*step
+	if sq(r-gv)+sq(g-gv)+sq(b-gv) < cubeDist {
+		return 232 + step
+	}
+	return 16 + 36*ri + 6*gi + bi
+}
+
+func sq(v int) int { return v * v }
+
+// ansiHues are the indices of the basic ANSI colors red, yellow, green, cyan,
+// blue and magenta in order of hue, 60 degrees apart.
+var ansiHues = [6]int{1, 3, 2, 6, 4, 5}
+
+// to16 returns the index of the basic ANSI color which best stands in for the
+// given color. The pale colors given to keys are far from every basic color
+// by distance, so colors are matched by hue, even when they are dark, and only
+// colors with little saturation are mapped to white, gray or bright black.
+// Black itself is never chosen, as it is invisible on a dark background.
+// Light colors are given the bright variants, 8 through 15.
+func to16(r, g, b int) int {
+	h, sat, v := colorful.Color{R: float64(r) / 255, G: float64(g) / 255, B: float64(b) / 255}.Hsv()
+	if sat < .2 {
+		switch {
+		case v > .85:
+			return 15
+		case v > .6:
+			return 7
+		}
+		return 8
+	}
+	i := ansiHues[int(math.Round(h/60))%6]
+	if v > .6 {
+		i += 8
+	}
+	return i
+}
+
+var truecolorSGR = regexp.MustCompile(`\x1b\[([34])8;2;(\d+);(\d+);(\d+)m`)
+
+// downsample rewrites the 24-bit color escape sequences in b to those of the
+// nearest colors of the 256 color palette, or of the 16 basic ANSI colors if
+// depth is 16.
+func downsample(b []byte, depth int) []byte {
+	return truecolorSGR.ReplaceAllFunc(b, func(seq []byte) []byte {
+		m := truecolorSGR.FindSubmatch(seq)
+		r, _ := strconv.Atoi(string(m[2]))
+		g, _ := strconv.Atoi(string(m[3]))
+		bl, _ := strconv.Atoi(string(m[4]))
+		if depth != 16 {
+			return []byte(fmt.Sprintf("\x1b[%s8;5;%dm", m[1], to256(r, g, bl)))
+		}
+		// Foreground colors are 30-37 and 90-97, backgrounds 40-47 and 100-107.
+		i, base := to16(r, g, bl), 30
+		if m[1][0] == '4' {
+			base = 40
+		}
+		if i >= 8 {
+			i, base = i-8, base+60
+		}
+		return []byte(fmt.Sprintf("\x1b[%dm", base+i))
+	})
+}
+
+// stablePalette holds the indices of the colors of the cube which are neither
+// gray nor too dark to read on a dark background.
+var stablePalette = func() []int {
+	var p []int
+	for r := 0; r < 6; r++ {
+		for g := 0; g < 6; g++ {
+			for b := 0; b < 6; b++ {
+				if (r == g && g == b) || r+g+b < 6 {
+					continue
+				}
+				p = append(p, 16+36*r+6*g+b)
+			}
+		}
+	}
+	return p
+}()
+
+// stableIndex returns the index of stablePalette chosen by the hash of s.
+func stableIndex(s string) int {
+	sum := keyHash(s)
+	return stablePalette[binary.BigEndian.Uint64(sum[:8])%uint64(len(stablePalette))]
+}
+
+// stableIndexRGB returns the color of the stableIndex of s. As the color is
+// exactly that of a palette entry, downsample maps it back to that index.
+func stableIndexRGB(s string) (r, g, b uint8) {
+	i := stableIndex(s) - 16
+	return uint8(cubeLevels[i/36]), uint8(cubeLevels[i/6%6]), uint8(cubeLevels[i%6])
+}
+
+// paletteHex returns the color of the index n of the 256 color palette.
+func paletteHex(n int) string {
+	var r, g, b int
+	switch {
+	case n < 16:
+		r, g, b = ansi16RGB[n&15][0], ansi16RGB[n&15][1], ansi16RGB[n&15][2]
+	case n < 232:
+		n -= 16
+		r, g, b = cubeLevels[n/36], cubeLevels[n/6%6], cubeLevels[n%6]
+	default:
+		r = 8 + 10*(n-232)
+		g, b = r, r
+	}
+	return fmt.Sprintf("#%02x%02x%02x", r&0xff, g&0xff, b&0xff)
+}
+
+// ansi16RGB are the colors of the 16 basic ANSI colors as xterm renders them.
+var ansi16RGB = [16][3]int{
+	{0, 0, 0}, {205, 0, 0}, {0, 205, 0}, {205, 205, 0},
+	{0, 0, 238}, {205, 0, 205}, {0, 205, 205}, {229, 229, 229},
+	{127, 127, 127}, {255, 0, 0}, {0, 255, 0}, {255, 255, 0},
+	{92, 92, 255}, {255, 0, 255}, {0, 255, 255}, {255, 255, 255},
+}
@@ -0,0 +1,64 @@
+// Copyright 2018 Andrew Werner, All Rights Reserved.
+
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// TestStableIndexGolden pins the palette index chosen for each of a set of
+// keys, as snapshots taken with -stable-index depend on it.
+func TestStableIndexGolden(t *testing.T) {
+	var buf strings.Builder
+	for _, k := range []string{"", "n1> ", "n2> ", "n3> ", "api", "db", "worker-1", "worker-2", "日本"} {
+		i := stableIndex(k)
+		r, g, b := stableIndexRGB(k)
+		if got := to256(int(r), int(g), int(b)); got != i {
+			t.Errorf("the color of index %d of %q maps back to index %d", i, k, got)
+		}
+		fmt.Fprintf(&buf, "%q %d\n", k, i)
+	}
+	checkGolden(t, "stable-index.golden", buf.String())
+}
+
+func TestStableIndexOutput(t *testing.T) {
+	out := runMain(t, readFixture(t, "glog.log"), "-color", "always", "-color-depth", "256", "-stable-index")
+	if strings.Contains(out, "38;2;") {
+		t.Errorf("output contains truecolor escapes:\n%s", out)
+	}
+	checkGolden(t, "glog.stable-index.golden", out)
+}
+
+func TestTo16(t *testing.T) {
+	for _, c := range []struct {
+		r, g, b int
+		exp     int
+	}{
+		{0, 0, 0, 8},
+		{40, 40, 40, 8},
+		{128, 128, 128, 8},
+		{190, 190, 190, 7},
+		{255, 255, 255, 15},
+		// Dark colors keep their hue rather than turning black.
+		{60, 10, 10, 1},
+		{10, 20, 70, 4},
+		{20, 60, 20, 2},
+		{200, 40, 40, 9},
+		{255, 180, 180, 9},
+		{120, 220, 120, 10},
+		{100, 200, 220, 14},
+	} {
+		if got := to16(c.r, c.g, c.b); got != c.exp {
+			t.Errorf("to16(%d, %d, %d) = %d, expected %d", c.r, c.g, c.b, got, c.exp)
+		}
+	}
+}
+
+func TestDownsample16Dark(t *testing.T) {
+	got := string(downsample([]byte("\x1b[38;2;60;10;10mx\x1b[39m"), 16))
+	if exp := "\x1b[31mx\x1b[39m"; got != exp {
+		t.Errorf("downsample = %q, expected %q", got, exp)
+	}
+}
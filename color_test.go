@@ -0,0 +1,209 @@
+// Copyright 2018 Andrew Werner, All Rights Reserved.
+
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+func TestColorNameFollowsHashInput(t *testing.T) {
+	m := newColorMap()
+	m.keyLength = 3
+	if a, b := m.colorName("node1"), m.colorName("node2"); a != b {
+		t.Errorf("keys sharing a -color-key-length prefix were named %q and %q", a, b)
+	}
+	seeded := newColorMap()
+	seeded.seed = "x"
+	if got, want := seeded.colorName("node1"), newColorMap().colorName("xnode1"); got != want {
+		t.Errorf("seeded name %q, expected the name of the seeded hash input %q", got, want)
+	}
+}
+
+func TestTruncateKey(t *testing.T) {
+	for _, c := range []struct {
+		n   int
+		key string
+		exp string
+	}{
+		{0, "node-1.us-east", "node-1.us-east"},
+		{4, "node-1.us-east", "node"},
+		{-4, "node-1.us-east", "east"},
+		{20, "node-1", "node-1"},
+		{-20, "node-1", "node-1"},
+		{2, "日本語", "日本"},
+		{-1, "日本語", "語"},
+	} {
+		m := newColorMap()
+		m.keyLength = c.n
+		if got := m.truncateKey(c.key); got != c.exp {
+			t.Errorf("truncateKey(%q) with length %d = %q, expected %q", c.key, c.n, got, c.exp)
+		}
+	}
+}
+
+func TestColorKeyLength(t *testing.T) {
+	m := newColorMap()
+	m.keyLength = 4
+	if a, b := m.getColor("node-1"), m.getColor("node-2"); a.Sprint("x") != b.Sprint("x") {
+		t.Error("keys sharing a prefix of -color-key-length were colored differently")
+	}
+	m = newColorMap()
+	m.keyLength = -3
+	if a, b := m.getColor("a.east"), m.getColor("b.east"); a.Sprint("x") != b.Sprint("x") {
+		t.Error("keys sharing a suffix of -color-key-length -3 were colored differently")
+	}
+	if a, b := m.getColor("a.east"), m.getColor("a.west"); a.Sprint("x") == b.Sprint("x") {
+		t.Error("keys with different suffixes were colored alike")
+	}
+}
+
+func TestShortID(t *testing.T) {
+	m := newColorMap()
+	id := m.shortID("node1")
+	if len(id) != 6 || strings.Trim(id, "0123456789abcdef") != "" {
+		t.Fatalf("shortID = %q, expected 6 hex digits", id)
+	}
+	if again := m.shortID("node1"); again != id {
+		t.Errorf("shortID is not stable: %q then %q", id, again)
+	}
+	if other := m.shortID("node2"); other == id {
+		t.Errorf("node1 and node2 share the id %q", id)
+	}
+	sum := keyHash("node1")
+	if exp := hex.EncodeToString(sum[:3]); id != exp {
+		t.Errorf("shortID = %q, expected the prefix of the color hash %q", id, exp)
+	}
+	m.keyLength = 4
+	if a, b := m.shortID("node1"), m.shortID("node2"); a != b {
+		t.Errorf("keys colored alike by -color-key-length have ids %q and %q", a, b)
+	}
+
+	tmpl, err := newTemplate(`{{ shortid .Header }}`, newColorMap(), newColorMap().getColor, nil, nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, LogEntry{Entry: Entry{Header: "node1"}}); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != id {
+		t.Errorf("template shortid = %q, expected %q", buf.String(), id)
+	}
+}
+
+func TestNoColorTemplate(t *testing.T) {
+	noColor = true
+	defer func() { noColor = false }()
+	m := newColorMap()
+	tmpl, err := newTemplate(
+		`{{ (color .Header).Sprint .Header }} {{ bold .Header }} {{ dim .Header }} {{ underline .Header }} {{ levelchip "ERROR" }} {{ (statuscolor "500").Sprint "500" }}`,
+		m, m.getColor, nil, nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, LogEntry{Entry: Entry{Header: "n1"}}); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(buf.String(), "\x1b[") {
+		t.Errorf("output contains escape sequences: %q", buf.String())
+	}
+}
+
+func TestBold(t *testing.T) {
+	for _, c := range []struct {
+		s, exp string
+	}{
+		{"", ""},
+		{"x", "\x1b[1mx\x1b[22m"},
+		{"x\n", "\x1b[1mx\x1b[22m\n"},
+		{"\x1b[38;2;1;2;3mx\x1b[39m", "\x1b[1m\x1b[38;2;1;2;3mx\x1b[39m\x1b[22m"},
+	} {
+		if got := bold(c.s); got != c.exp {
+			t.Errorf("bold(%q) = %q, expected %q", c.s, got, c.exp)
+		}
+	}
+	noColor = true
+	defer func() { noColor = false }()
+	if got := bold("x\n"); got != "x\n" {
+		t.Errorf("bold with color disabled = %q, expected %q", got, "x\n")
+	}
+}
+
+func TestBoldTemplate(t *testing.T) {
+	args := []string{"-log-header-pattern", `(?P<prefix>\w+): `, "-output-template", `{{ bold .Header }}{{ .Message }}`}
+	if got, exp := runMain(t, "a: b\n", append(args, "-color", "always")...), "\x1b[1ma: \x1b[22mb\n"; got != exp {
+		t.Errorf("-color always: got %q, expected %q", got, exp)
+	}
+	if got, exp := runMain(t, "a: b\n", append(args, "-color", "never")...), "a: b\n"; got != exp {
+		t.Errorf("-color never: got %q, expected %q", got, exp)
+	}
+}
+
+func TestDimUnderline(t *testing.T) {
+	for _, c := range []struct {
+		name string
+		f    func(string) string
+		s    string
+		exp  string
+	}{
+		{"dim", dim, "x", "\x1b[2mx\x1b[22m"},
+		{"dim", dim, "x\n\n", "\x1b[2mx\x1b[22m\n\n"},
+		{"dim", dim, "", ""},
+		{"underline", underline, "x", "\x1b[4mx\x1b[24m"},
+		{"underline", underline, "x\n", "\x1b[4mx\x1b[24m\n"},
+		{"underline", underline, "", ""},
+		{"bold dim", func(s string) string { return bold(dim(s)) }, "x", "\x1b[1m\x1b[2mx\x1b[22m\x1b[22m"},
+		{"underline bold", func(s string) string { return underline(bold(s)) }, "x", "\x1b[4m\x1b[1mx\x1b[22m\x1b[24m"},
+	} {
+		if got := c.f(c.s); got != c.exp {
+			t.Errorf("%v(%q) = %q, expected %q", c.name, c.s, got, c.exp)
+		}
+	}
+	noColor = true
+	defer func() { noColor = false }()
+	for name, f := range map[string]func(string) string{"dim": dim, "underline": underline} {
+		if got := f("x\n"); got != "x\n" {
+			t.Errorf("%v with color disabled = %q, expected %q", name, got, "x\n")
+		}
+	}
+}
+
+func TestDimUnderlineTemplate(t *testing.T) {
+	args := []string{"-log-header-pattern", `(?P<prefix>\w+): `, "-output-template", `{{ underline .Header }}{{ dim .Message }}`}
+	if got, exp := runMain(t, "a: b\n", append(args, "-color", "always")...), "\x1b[4ma: \x1b[24m\x1b[2mb\x1b[22m\n"; got != exp {
+		t.Errorf("-color always: got %q, expected %q", got, exp)
+	}
+	if got, exp := runMain(t, "a: b\n", append(args, "-color", "never")...), "a: b\n"; got != exp {
+		t.Errorf("-color never: got %q, expected %q", got, exp)
+	}
+}
+
+func TestSeverityColorTemplate(t *testing.T) {
+	m := newColorMap()
+	for _, name := range []string{"severityColor", "severitycolor"} {
+		tmpl, err := newTemplate(`{{ (`+name+` .Header).Sprint .Header }}`, m, m.getColor, nil, nil, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for sev, col := range severityColors {
+			var buf bytes.Buffer
+			if err := tmpl.Execute(&buf, LogEntry{Entry: Entry{Header: sev}}); err != nil {
+				t.Fatal(err)
+			}
+			if exp := col.Sprint(sev); buf.String() != exp {
+				t.Errorf("%v %q = %q, expected %q", name, sev, buf.String(), exp)
+			}
+		}
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, LogEntry{Entry: Entry{Header: "node1"}}); err != nil {
+			t.Fatal(err)
+		}
+		if exp := m.getColor("node1").Sprint("node1"); buf.String() != exp {
+			t.Errorf("%v of an unknown severity = %q, expected %q", name, buf.String(), exp)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+// Copyright 2018 Andrew Werner, All Rights Reserved.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/lucasb-eyer/go-colorful"
+)
+
+// colorMapFile is the form in which -dump-color-map writes the colors of a
+// colorMap and from which -load-color-map reads them. The settings which
+// determined the colors are recorded alongside them for reference; they are
+// not applied when the file is loaded.
+type colorMapFile struct {
+	KeyLength   int               `json:"key_length,omitempty"`
+	Seed        string            `json:"seed,omitempty"`
+	ColorRing   int               `json:"color_ring,omitempty"`
+	StableIndex bool              `json:"stable_index,omitempty"`
+	Chroma      [2]float64        `json:"chroma"`
+	Lightness   [2]float64        `json:"lightness"`
+	Colors      map[string]string `json:"colors"`
+}
+
+// dump writes the color of every key m has colored to the file at path. If
+// keepLoaded is set, the colors of loaded keys which were not seen are written
+// as well, so that the file accumulates keys over several runs.
+func (m *colorMap) dump(path string, keepLoaded bool) error {
+	f := colorMapFile{
+		KeyLength:   m.keyLength,
+		Seed:        m.seed,
+		StableIndex: m.stableIndex,
+		Chroma:      [2]float64{m.chroma.min, m.chroma.max},
+		Lightness:   [2]float64{m.lightness.min, m.lightness.max},
+		Colors:      make(map[string]string, len(m.values)),
+	}
+	if m.ring != nil {
+		f.ColorRing = m.ring.size
+	}
+	if keepLoaded {
+		for k, c := range m.loaded {
+			f.Colors[k] = c.Hex()
+		}
+	}
+	for k, c := range m.values {
+		f.Colors[k] = c.Hex()
+	}
+	out, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(out)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(&f); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// load reads the colors of the file at path written by dump. Keys in the file
+// are given their recorded colors in place of the ones they would be assigned.
+// Colors loaded from several files accumulate, the last file taking
+// precedence.
+func (m *colorMap) load(path string) error {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var f colorMapFile
+	if err := json.Unmarshal(b, &f); err != nil {
+		return fmt.Errorf("invalid color map %v: %v", path, err)
+	}
+	if m.loaded == nil {
+		m.loaded = make(map[string]colorful.Color, len(f.Colors))
+	}
+	for k, hex := range f.Colors {
+		c, err := colorful.Hex(hex)
+		if err != nil {
+			return fmt.Errorf("invalid color map %v: key %q: %v", path, k, err)
+		}
+		m.loaded[k] = c
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+// Copyright 2018 Andrew Werner, All Rights Reserved.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestColorMapRoundTrip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "logcolor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "colors.json")
+
+	m := newColorMap()
+	m.seed = "x"
+	keys := []string{"n1> ", "n2> ", "api", "日本"}
+	exp := make(map[string]string, len(keys))
+	for _, k := range keys {
+		exp[k] = m.getColor(k).Sprint(k)
+	}
+	if err := m.dump(path, false); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded := newColorMap()
+	if err := loaded.load(path); err != nil {
+		t.Fatal(err)
+	}
+	if len(loaded.loaded) != len(keys) {
+		t.Fatalf("loaded %d colors, expected %d", len(loaded.loaded), len(keys))
+	}
+	for _, k := range keys {
+		if got := loaded.getColor(k).Sprint(k); got != exp[k] {
+			t.Errorf("%q colored %q after loading, expected %q", k, got, exp[k])
+		}
+	}
+
+	// Dumping the loaded colors with keepLoaded writes them back unchanged.
+	if err := loaded.dump(path, true); err != nil {
+		t.Fatal(err)
+	}
+	again := newColorMap()
+	if err := again.load(path); err != nil {
+		t.Fatal(err)
+	}
+	for k, c := range loaded.loaded {
+		if again.loaded[k].Hex() != c.Hex() {
+			t.Errorf("%q reloaded as %v, expected %v", k, again.loaded[k].Hex(), c.Hex())
+		}
+	}
+}
+
+func TestLoadColorMapErrors(t *testing.T) {
+	dir, err := ioutil.TempDir("", "logcolor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for name, contents := range map[string]string{
+		"invalid.json": `{"colors": `,
+		"bad-hex.json": `{"colors": {"a": "red"}}`,
+	} {
+		path := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(path, []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := newColorMap().load(path); err == nil {
+			t.Errorf("loading %v succeeded, expected an error", name)
+		}
+	}
+}
+
+// TestColorMapFlags checks that output colored with a map written by
+// -dump-color-map is unchanged by settings which would otherwise recolor it.
+func TestColorMapFlags(t *testing.T) {
+	dir, err := ioutil.TempDir("", "logcolor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "colors.json")
+	in := readFixture(t, "glog.log")
+	exp := runMain(t, in, "-color", "always", "-dump-color-map", path)
+	if reseeded := runMain(t, in, "-color", "always", "-color-seed", "x"); reseeded == exp {
+		t.Fatal("-color-seed did not change the colors")
+	}
+	if got := runMain(t, in, "-color", "always", "-color-seed", "x", "-load-color-map", path); got != exp {
+		t.Errorf("output with -load-color-map differs:\ngot:\n%s\nexpected:\n%s", got, exp)
+	}
+}
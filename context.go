@@ -0,0 +1,42 @@
+// Copyright 2018 Andrew Werner, All Rights Reserved.
+
+package main
+
+import "regexp"
+
+// contextKeys carries color keys across related entries. An entry mentioning
+// a context id, such as the id of a request, is given the color key of the
+// first entry which mentioned that id, so that follow-up entries share the
+// color of the entry which began the request even if they come from elsewhere.
+type contextKeys struct {
+	re   *regexp.Regexp
+	keys map[string]string
+}
+
+func newContextKeys(re *regexp.Regexp) *contextKeys {
+	return &contextKeys{re: re, keys: map[string]string{}}
+}
+
+// resolve returns the color key of an entry with the given text and own color
+// key. If the text holds a context id which was seen before with a color key,
+// that key is returned and otherwise the id is associated with key.
+func (c *contextKeys) resolve(text, key string) string {
+	m := c.re.FindStringSubmatch(text)
+	if m == nil {
+		return key
+	}
+	id := m[0]
+	for _, s := range m[1:] {
+		if s != "" {
+			id = s
+			break
+		}
+	}
+	if k, ok := c.keys[id]; ok {
+		return k
+	}
+	if key != "" {
+		c.keys[id] = key
+	}
+	return key
+}
@@ -0,0 +1,71 @@
+// Copyright 2018 Andrew Werner, All Rights Reserved.
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+
+	"github.com/wayneashleyberry/truecolor/pkg/color"
+)
+
+// debugMatch writes each line read from r to w, marked with + if the pattern
+// matches it and - if it does not. In matching lines the text captured by each
+// group is colored by the group's name, and the span of each group which
+// participated in the match is listed beneath the line.
+func debugMatch(
+	w io.Writer, r io.Reader, pattern *regexp.Regexp, getColor func(string) *color.Message,
+) error {
+	names := pattern.SubexpNames()
+	for i, n := range names {
+		if n == "" {
+			names[i] = strconv.Itoa(i)
+		}
+	}
+	bw := bufio.NewWriter(w)
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		line := s.Text()
+		m := pattern.FindStringSubmatchIndex(line)
+		if m == nil {
+			fmt.Fprintf(bw, "- %s\n", line)
+			continue
+		}
+		// Color each byte by the innermost, that is the last, group which
+		// captured it.
+		owner := make([]int, len(line))
+		for g := 1; 2*g < len(m); g++ {
+			for i := m[2*g]; i >= 0 && i < m[2*g+1]; i++ {
+				owner[i] = g
+			}
+		}
+		bw.WriteString("+ ")
+		for start := 0; start < len(line); {
+			end := start + 1
+			for end < len(line) && owner[end] == owner[start] {
+				end++
+			}
+			if g := owner[start]; g > 0 {
+				bw.WriteString(getColor(names[g]).Sprint(line[start:end]))
+			} else {
+				bw.WriteString(line[start:end])
+			}
+			start = end
+		}
+		bw.WriteByte('\n')
+		for g := 1; 2*g < len(m); g++ {
+			if m[2*g] < 0 {
+				continue
+			}
+			fmt.Fprintf(bw, "    %s [%d:%d] %q\n", getColor(names[g]).Sprint(names[g]),
+				m[2*g], m[2*g+1], line[m[2*g]:m[2*g+1]])
+		}
+	}
+	if err := s.Err(); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
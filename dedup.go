@@ -0,0 +1,82 @@
+// Copyright 2018 Andrew Werner, All Rights Reserved.
+
+package main
+
+import (
+	"container/list"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/wayneashleyberry/truecolor/pkg/color"
+)
+
+// dedupWindow remembers the signatures of the most recently seen distinct
+// messages so that repeats of them, which may differ in the numbers they
+// contain, can be suppressed even when other messages come between them. Its
+// memory is bounded by its size regardless of the input.
+type dedupWindow struct {
+	size    int
+	lru     *list.List
+	entries map[string]*list.Element
+}
+
+type dedupEntry struct {
+	id       string
+	colorKey string
+	message  string
+	repeats  int
+}
+
+func newDedupWindow(size int) *dedupWindow {
+	return &dedupWindow{
+		size:    size,
+		lru:     list.New(),
+		entries: map[string]*list.Element{},
+	}
+}
+
+// add records an entry and returns whether its message has the signature of
+// one of the same color key in the window. If adding the entry evicted a
+// message which had been repeated, that message is returned so that its
+// repeats can be reported.
+func (w *dedupWindow) add(colorKey, message string) (repeat bool, evicted *dedupEntry) {
+	id := colorKey + "\x00" + signature(message)
+	if e, ok := w.entries[id]; ok {
+		w.lru.MoveToFront(e)
+		e.Value.(*dedupEntry).repeats++
+		return true, nil
+	}
+	w.entries[id] = w.lru.PushFront(&dedupEntry{id: id, colorKey: colorKey, message: message})
+	if w.lru.Len() <= w.size {
+		return false, nil
+	}
+	oldest := w.lru.Remove(w.lru.Back()).(*dedupEntry)
+	delete(w.entries, oldest.id)
+	if oldest.repeats == 0 {
+		return false, nil
+	}
+	return false, oldest
+}
+
+// flush removes and returns the repeated messages in the window, least
+// recently seen first.
+func (w *dedupWindow) flush() []*dedupEntry {
+	var repeated []*dedupEntry
+	for e := w.lru.Back(); e != nil; e = e.Prev() {
+		if de := e.Value.(*dedupEntry); de.repeats > 0 {
+			repeated = append(repeated, de)
+		}
+	}
+	w.lru.Init()
+	w.entries = map[string]*list.Element{}
+	return repeated
+}
+
+// report writes a line noting the number of times the entry's message was
+// repeated.
+func (e *dedupEntry) report(w io.Writer, getColor func(string) *color.Message) error {
+	_, err := fmt.Fprintf(w, "%s (repeated %d more times)\n",
+		getColor(e.colorKey).Sprint(strings.TrimSpace(firstLine(e.message))), e.repeats)
+	return err
+}
@@ -0,0 +1,29 @@
+// Copyright 2018 Andrew Werner, All Rights Reserved.
+
+package main
+
+import "testing"
+
+func TestDedupWindowSignatures(t *testing.T) {
+	w := newDedupWindow(2)
+	for _, tc := range []struct {
+		key, message string
+		repeat       bool
+	}{
+		{"a", " took 12ms\n", false},
+		{"a", " took 340ms\n", true},
+		{"b", " took 12ms\n", false},
+		{"a", " connected to 10.0.0.1\n", false},
+		// The first message has been evicted by the two distinct ones after
+		// it.
+		{"a", " took 5ms\n", false},
+	} {
+		if repeat, _ := w.add(tc.key, tc.message); repeat != tc.repeat {
+			t.Errorf("add(%q, %q) repeat = %v, expected %v", tc.key, tc.message, repeat, tc.repeat)
+		}
+	}
+	repeated := w.flush()
+	if len(repeated) != 0 {
+		t.Errorf("flush() returned %d repeated messages, expected none as the repeated one was evicted", len(repeated))
+	}
+}
@@ -0,0 +1,57 @@
+// Copyright 2018 Andrew Werner, All Rights Reserved.
+
+package main
+
+import (
+	"io"
+	"os"
+
+	"github.com/wayneashleyberry/truecolor/pkg/color"
+)
+
+// referenceSignatures returns the signatures of the messages of the entries
+// decoded by d, which are compared with the signatures of later entries to
+// find the entries which are new.
+func referenceSignatures(d decoder) (map[string]struct{}, error) {
+	sigs := map[string]struct{}{}
+	var e Entry
+	for {
+		switch err := d.Decode(&e); err {
+		case nil:
+			sigs[signature(e.Message)] = struct{}{}
+		case io.EOF:
+			return sigs, nil
+		default:
+			return nil, err
+		}
+	}
+}
+
+// loadReference opens the file at path and returns the signatures of its
+// entries as decoded by the decoder returned by newDecoder.
+func loadReference(
+	path string, newDecoder func(io.Reader) (decoder, error),
+) (map[string]struct{}, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	d, err := newDecoder(f)
+	if err != nil {
+		return nil, err
+	}
+	return referenceSignatures(d)
+}
+
+// Gutters written before entries when comparing against a reference.
+var (
+	newGutter       = color.Color(0x66, 0xbb, 0x6a).Sprint("+ ")
+	unchangedGutter = "  "
+)
+
+// SGR escape sequences which color the messages of new entries.
+const (
+	sgrNew          = "\x1b[38;2;102;187;106m"
+	sgrDefaultColor = "\x1b[39m"
+)
@@ -0,0 +1,114 @@
+// Copyright 2018 Andrew Werner, All Rights Reserved.
+
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// dockerStreams are the names of the streams of a multiplexed Docker attach or
+// logs stream, indexed by the stream type in the frame header.
+var dockerStreams = [...]string{"stdin", "stdout", "stderr", "systemerr"}
+
+// dockerMaxFrame is the largest payload of a frame which is accepted. Docker
+// writes frames of at most a few tens of kilobytes, so a larger length means
+// that the input is not a multiplexed stream or is corrupt.
+const dockerMaxFrame = 16 << 20
+
+// NewDockerReader returns a reader which demultiplexes the stream returned by
+// the Docker API for containers without a TTY. Each frame of that stream is
+// an 8 byte header holding the stream type and the big endian length of the
+// payload which follows it. Each line of the payloads is prefixed with the
+// name of its stream followed by "> ", the format of the prefix matched by
+// the glog preset, so that entries are colored by their stream. Lines are
+// reassembled across frames so that lines of different streams do not mix.
+//
+// If a frame header is invalid, with an unknown stream type or a payload
+// longer than dockerMaxFrame, the rest of the input is passed through as it
+// is rather than demultiplexed.
+func NewDockerReader(r io.Reader) io.Reader {
+	return &dockerReader{r: r}
+}
+
+type dockerReader struct {
+	r   io.Reader
+	hdr [8]byte
+	// partial holds the unterminated last line of each stream.
+	partial [len(dockerStreams)][]byte
+	out     bytes.Buffer
+	err     error
+	// passthrough is set once an invalid frame header has been read.
+	passthrough bool
+}
+
+func (r *dockerReader) Read(buf []byte) (int, error) {
+	if r.passthrough && r.out.Len() == 0 {
+		return r.r.Read(buf)
+	}
+	for r.out.Len() == 0 && r.err == nil && !r.passthrough {
+		r.err = r.readFrame()
+	}
+	if r.out.Len() > 0 {
+		return r.out.Read(buf)
+	}
+	return 0, r.err
+}
+
+// readFrame reads the next frame and writes its complete lines to r.out. At
+// the end of the input the remaining partial lines are written.
+func (r *dockerReader) readFrame() error {
+	if _, err := io.ReadFull(r.r, r.hdr[:]); err != nil {
+		if err == io.EOF {
+			r.flushPartial()
+		}
+		if err == io.ErrUnexpectedEOF {
+			err = fmt.Errorf("truncated docker frame header")
+		}
+		return err
+	}
+	stream, size := int(r.hdr[0]), binary.BigEndian.Uint32(r.hdr[4:])
+	if stream >= len(dockerStreams) || r.hdr[1] != 0 || r.hdr[2] != 0 || r.hdr[3] != 0 || size > dockerMaxFrame {
+		r.flushPartial()
+		r.out.Write(r.hdr[:])
+		r.passthrough = true
+		return nil
+	}
+	payload := make([]byte, size)
+	if _, err := io.ReadFull(r.r, payload); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			err = fmt.Errorf("truncated docker frame")
+		}
+		return err
+	}
+	data := append(r.partial[stream], payload...)
+	for {
+		i := bytes.IndexByte(data, '\n')
+		if i < 0 {
+			break
+		}
+		r.writeLine(stream, data[:i+1])
+		data = data[i+1:]
+	}
+	r.partial[stream] = append([]byte(nil), data...)
+	return nil
+}
+
+// flushPartial writes the unterminated last line of each stream.
+func (r *dockerReader) flushPartial() {
+	for i, p := range r.partial {
+		if len(p) > 0 {
+			r.writeLine(i, p)
+			r.out.WriteByte('\n')
+			r.partial[i] = nil
+		}
+	}
+}
+
+func (r *dockerReader) writeLine(stream int, line []byte) {
+	r.out.WriteString(dockerStreams[stream])
+	r.out.WriteString("> ")
+	r.out.Write(line)
+}
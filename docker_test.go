@@ -0,0 +1,72 @@
+// Copyright 2018 Andrew Werner, All Rights Reserved.
+
+package main
+
+import (
+	"encoding/binary"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+// dockerFrame returns a frame of a multiplexed Docker stream.
+func dockerFrame(stream byte, payload string) string {
+	hdr := make([]byte, 8)
+	hdr[0] = stream
+	binary.BigEndian.PutUint32(hdr[4:], uint32(len(payload)))
+	return string(hdr) + payload
+}
+
+func TestDockerReader(t *testing.T) {
+	for _, tc := range []struct {
+		name, in, out string
+	}{
+		{
+			name: "streams",
+			in: dockerFrame(1, "starting\n") +
+				dockerFrame(2, "warn: low disk\n") +
+				dockerFrame(3, "oci runtime error\n"),
+			out: "stdout> starting\nstderr> warn: low disk\nsystemerr> oci runtime error\n",
+		},
+		{
+			name: "lines split across frames",
+			in: dockerFrame(1, "hel") +
+				dockerFrame(2, "err\n") +
+				dockerFrame(1, "lo\nwor") +
+				dockerFrame(1, "ld\n"),
+			out: "stderr> err\nstdout> hello\nstdout> world\n",
+		},
+		{
+			name: "unterminated last line",
+			in:   dockerFrame(1, "no newline"),
+			out:  "stdout> no newline\n",
+		},
+		{
+			name: "not framed",
+			in:   "I181015 10:00:00.000001 plain text\n",
+			out:  "I181015 10:00:00.000001 plain text\n",
+		},
+		{
+			name: "oversized frame",
+			in:   dockerFrame(1, "ok\n") + "\x01\x00\x00\x00\xff\xff\xff\xffrest\n",
+			out:  "stdout> ok\n\x01\x00\x00\x00\xff\xff\xff\xffrest\n",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			out, err := ioutil.ReadAll(NewDockerReader(strings.NewReader(tc.in)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(out) != tc.out {
+				t.Errorf("got %q, expected %q", out, tc.out)
+			}
+		})
+	}
+}
+
+func TestDockerReaderTruncated(t *testing.T) {
+	in := dockerFrame(1, "complete\n") + dockerFrame(1, "truncated")[:12]
+	if _, err := ioutil.ReadAll(NewDockerReader(strings.NewReader(in))); err == nil {
+		t.Error("expected an error reading a truncated frame")
+	}
+}
@@ -0,0 +1,37 @@
+// Copyright 2018 Andrew Werner, All Rights Reserved.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/unicode"
+	"golang.org/x/text/transform"
+)
+
+// NewDecodingReader returns a reader which transcodes the text read from r in
+// the named encoding to UTF-8. The supported encodings are utf-8, for which r
+// is returned unchanged, latin1 and utf-16, utf-16le and utf-16be. Text in
+// utf-16 is big endian unless it begins with a byte order mark saying
+// otherwise. A leading byte order mark is removed from all utf-16 text and
+// takes precedence over the byte order named by the encoding.
+func NewDecodingReader(r io.Reader, enc string) (io.Reader, error) {
+	var e encoding.Encoding
+	switch strings.ToLower(enc) {
+	case "utf-8", "utf8":
+		return r, nil
+	case "latin1", "latin-1", "iso-8859-1":
+		e = charmap.ISO8859_1
+	case "utf-16", "utf16", "utf-16be", "utf16be":
+		e = unicode.UTF16(unicode.BigEndian, unicode.UseBOM)
+	case "utf-16le", "utf16le":
+		e = unicode.UTF16(unicode.LittleEndian, unicode.UseBOM)
+	default:
+		return nil, fmt.Errorf("unsupported input encoding %v", enc)
+	}
+	return transform.NewReader(r, e.NewDecoder()), nil
+}
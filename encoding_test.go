@@ -0,0 +1,47 @@
+// Copyright 2018 Andrew Werner, All Rights Reserved.
+
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+)
+
+func TestDecodingReader(t *testing.T) {
+	for _, c := range []struct {
+		name     string
+		encoding string
+		in       []byte
+		exp      string
+	}{
+		{"utf-8", "utf-8", []byte("héllo\n"), "héllo\n"},
+		{"latin1", "latin1", []byte{'h', 0xE9, 'l', 'l', 'o', '\n'}, "héllo\n"},
+		{"utf-16 defaults to big endian", "utf-16", []byte{0, 'h', 0, 'i'}, "hi"},
+		{"utf-16 big endian bom", "utf-16", []byte{0xFE, 0xFF, 0, 'h', 0, 'i'}, "hi"},
+		{"utf-16 little endian bom", "utf-16", []byte{0xFF, 0xFE, 'h', 0, 'i', 0}, "hi"},
+		{"utf-16le", "utf-16le", []byte{'h', 0, 'i', 0}, "hi"},
+		{"utf-16be", "utf-16be", []byte{0, 'h', 0, 'i'}, "hi"},
+		{"bom overrides utf-16le", "utf-16le", []byte{0xFE, 0xFF, 0, 'h', 0, 'i'}, "hi"},
+		{"surrogate pair", "utf-16be", []byte{0xD8, 0x3D, 0xDE, 0x00}, "\U0001F600"},
+		{"unpaired low surrogate", "utf-16be", []byte{0xDE, 0x00, 0, 'a'}, "�a"},
+		{"unpaired high surrogate", "utf-16be", []byte{0xD8, 0x3D, 0, 'a'}, "�a"},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			r, err := NewDecodingReader(bytes.NewReader(c.in), c.encoding)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := ioutil.ReadAll(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != c.exp {
+				t.Fatalf("got %q, expected %q", got, c.exp)
+			}
+		})
+	}
+	if _, err := NewDecodingReader(nil, "ebcdic"); err == nil {
+		t.Fatal("expected an error for an unsupported encoding")
+	}
+}
@@ -24,6 +24,8 @@ import (
 	"bytes"
 	"io"
 	"regexp"
+	"regexp/syntax"
+	"strings"
 	"sync"
 	"time"
 )
@@ -44,7 +46,7 @@ func NewBufferedReader(r io.Reader, idleTimeout time.Duration) io.Reader {
 		_, err := io.Copy(br, r)
 		br.mu.Lock()
 		defer br.mu.Unlock()
-		if err == io.EOF {
+		if err == nil {
 			br.err = io.ErrUnexpectedEOF
 		} else {
 			br.err = err
@@ -68,11 +70,12 @@ func (r *bufferedReader) Read(buf []byte) (n int, err error) {
 	for {
 		var thisN int
 		r.mu.Lock()
-		if r.err != nil {
-			r.mu.Unlock()
-			return n, err
-		}
 		thisN, err = r.buf.Read(buf)
+		if err == io.EOF && r.err != nil {
+			// Only report the error from the underlying reader once everything
+			// it wrote has been read.
+			err = r.err
+		}
 		r.mu.Unlock()
 		n += thisN
 		if err == nil || err != io.EOF {
@@ -106,21 +109,132 @@ func (r *bufferedReader) Write(data []byte) (n int, err error) {
 type Entry struct {
 	Header  string
 	Message string
+	// Offset is the offset in bytes of the start of the entry in the input.
+	Offset  int64
 	matches []int
+	// fields holds the fields of an entry decoded by a LineDecoder.
+	fields map[string]interface{}
 }
 
 type EntryDecoder struct {
-	re                 *regexp.Regexp
+	re *regexp.Regexp
+	// anchored is re anchored to the beginning of the text, if re only matches
+	// at the beginning of lines or the decoder is strict. See findHeader.
+	anchored           *regexp.Regexp
 	scanner            *bufio.Scanner
 	truncatedLastEntry bool
+	keepUnmatched      bool
+	strict             bool
+	indentBlocks       bool
+	// continuation, if set, is matched by the lines which continue an entry.
+	continuation *regexp.Regexp
+	// holdPartial and held are described by HoldPartial.
+	holdPartial bool
+	held        []byte
+
+	// offset is the input offset of the next byte to be split and
+	// tokenOffset is that of the most recently returned token.
+	offset, tokenOffset int64
 }
 
 func NewEntryDecoder(re *regexp.Regexp, r io.Reader) *EntryDecoder {
 	d := &EntryDecoder{re: re, scanner: bufio.NewScanner(r)}
-	d.scanner.Split(d.split)
+	if matchesLineStart(re) {
+		d.anchored = anchor(re)
+	}
+	d.scanner.Split(d.trackOffset)
 	return d
 }
 
+// matchesLineStart returns true if every match of re begins at the start of a
+// line.
+func matchesLineStart(re *regexp.Regexp) bool {
+	parsed, err := syntax.Parse(re.String(), syntax.Perl)
+	if err != nil {
+		return false
+	}
+	for parsed.Op == syntax.OpConcat || parsed.Op == syntax.OpCapture {
+		if len(parsed.Sub) == 0 {
+			return false
+		}
+		parsed = parsed.Sub[0]
+	}
+	return parsed.Op == syntax.OpBeginLine
+}
+
+// anchor returns re anchored to the beginning of the text.
+func anchor(re *regexp.Regexp) *regexp.Regexp {
+	return regexp.MustCompile(`^(?:` + re.String() + `)`)
+}
+
+// NewEntryDecoderSize is like NewEntryDecoder but the returned decoder's
+// initial read buffer has the given size, which must be positive and no larger
+// than bufio.MaxScanTokenSize.
+func NewEntryDecoderSize(re *regexp.Regexp, r io.Reader, size int) *EntryDecoder {
+	d := NewEntryDecoder(re, r)
+	d.scanner.Buffer(make([]byte, size), bufio.MaxScanTokenSize)
+	return d
+}
+
+// KeepUnmatched causes Decode to return text which does not belong to an entry
+// as an Entry with an empty Header rather than discarding it.
+func (d *EntryDecoder) KeepUnmatched() {
+	d.keepUnmatched = true
+}
+
+// Strict causes only headers which begin at the start of a line to begin
+// entries. By default a header anywhere in the text begins an entry, which
+// splits entries whose messages contain text like a header.
+func (d *EntryDecoder) Strict() {
+	d.strict = true
+	if d.anchored == nil {
+		d.anchored = anchor(d.re)
+	}
+}
+
+// IndentBlocks causes lines indented further than the line on which an entry's
+// header begins to belong to the entry even if they contain a header, so that
+// indented bodies such as YAML documents and Python tracebacks which contain
+// text like a header are kept whole.
+func (d *EntryDecoder) IndentBlocks() {
+	d.indentBlocks = true
+}
+
+// Continuation causes only the lines following the line on which an entry
+// begins which match re, such as lines which begin with whitespace or |, to
+// belong to the entry. The entry ends before the first line which does not,
+// and the text from that line up to the next header is unmatched.
+func (d *EntryDecoder) Continuation(re *regexp.Regexp) {
+	d.continuation = re
+}
+
+// HoldPartial causes the decoder to hold back the text which remains when its
+// input ends rather than returning it as a final entry, as when the input is
+// being followed that entry may still be being written. The held text is
+// returned by Held so that it can be decoded again along with the input which
+// follows it.
+func (d *EntryDecoder) HoldPartial() {
+	d.holdPartial = true
+}
+
+// Held returns the text held back by a decoder for which HoldPartial was
+// called once it has returned io.EOF. Offset includes the held text.
+func (d *EntryDecoder) Held() []byte {
+	return d.held
+}
+
+// SetOffset sets the offset in the input of the next byte read by the decoder.
+// It is used to compute Entry.Offset when the decoder does not start reading at
+// the beginning of the input.
+func (d *EntryDecoder) SetOffset(offset int64) {
+	d.offset = offset
+}
+
+// Offset returns the offset in the input of the next byte to be decoded.
+func (d *EntryDecoder) Offset() int64 {
+	return d.offset
+}
+
 func (d *EntryDecoder) Decode(e *Entry) error {
 	for {
 		if !d.scanner.Scan() {
@@ -132,22 +246,54 @@ func (d *EntryDecoder) Decode(e *Entry) error {
 		b := d.scanner.Bytes()
 		m := d.re.FindSubmatchIndex(b)
 		if m == nil {
-			continue
+			if !d.keepUnmatched {
+				continue
+			}
+			e.Header = ""
+			e.Message = stripCR(string(b))
+			e.Offset = d.tokenOffset
+			e.matches = nil
+			e.fields = nil
+			return nil
 		}
-		e.Header = string(b[m[0]:m[1]])
-		e.Message = string(b[m[1]:])
+		// Convert the entry to a string once and slice the header and message
+		// from it.
+		entry := string(b[m[0]:])
+		e.Header = entry[:m[1]-m[0]]
+		e.Message = stripCR(entry[m[1]-m[0]:])
+		e.Offset = d.tokenOffset + int64(m[0])
 		e.matches = m
+		e.fields = nil
 
 		return nil
 	}
 }
 
+// stripCR removes the carriage returns which end the lines of s, as they do
+// in logs written on Windows.
+func stripCR(s string) string {
+	if strings.IndexByte(s, '\r') < 0 {
+		return s
+	}
+	return strings.TrimSuffix(strings.Replace(s, "\r\n", "\n", -1), "\r")
+}
+
+// trackOffset calls split and records the offsets of the tokens it returns.
+func (d *EntryDecoder) trackOffset(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	advance, token, err = d.split(data, atEOF)
+	if token != nil {
+		d.tokenOffset = d.offset
+	}
+	d.offset += int64(advance)
+	return advance, token, err
+}
+
 func (d *EntryDecoder) split(data []byte, atEOF bool) (advance int, token []byte, err error) {
 	if atEOF && len(data) == 0 {
 		return 0, nil, nil
 	}
 	if d.truncatedLastEntry {
-		i := d.re.FindIndex(data)
+		i := d.findHeader(data)
 		if i == nil {
 			// If there's no entry that starts in this chunk, advance past it, since
 			// we've truncated the entry it was originally part of.
@@ -165,6 +311,10 @@ func (d *EntryDecoder) split(data []byte, atEOF bool) (advance int, token []byte
 	}
 	// From this point on, we assume we're currently positioned at a log entry.
 	onNoMatch := func() (int, []byte, error) {
+		if atEOF && d.holdPartial {
+			d.held = append(d.held[:0], data...)
+			return len(data), nil, nil
+		}
 		if atEOF {
 			return len(data), data, nil
 		}
@@ -178,14 +328,144 @@ func (d *EntryDecoder) split(data []byte, atEOF bool) (advance int, token []byte
 		// to truncate the entry.
 		return 0, nil, nil
 	}
-	i := d.re.FindIndex(data)
+	i := d.findHeader(data)
 	if i == nil {
 		return onNoMatch()
 	}
-	j := d.re.FindIndex(data[i[1]:])
-	if j == nil {
+	if i[0] > 0 {
+		// Text which precedes the first entry is returned as a token of its own.
+		return i[0], data[:i[0]], nil
+	}
+	j := d.nextHeader(data, i[1])
+	if d.continuation != nil {
+		end := len(data)
+		if j >= 0 {
+			end = j
+		}
+		k := d.continuationEnd(data[:end], i[1], j >= 0 || atEOF)
+		if k < 0 {
+			return onNoMatch()
+		}
+		if k < end {
+			return k, data[:k], nil
+		}
+	}
+	if j < 0 {
 		return onNoMatch()
 	}
-	// i[1]+j[0] is the start of the next log entry, but we need to adjust the value
-	return i[1] + j[0], data[:i[1]+j[0]], nil
+	return j, data[:j], nil
+}
+
+// continuationEnd returns the offset of the first line of data after the one
+// containing from which does not match the continuation pattern, or len(data)
+// if they all do. The last line of data is only matched if complete is set,
+// as otherwise the rest of it is yet to be read; if it must be matched to find
+// the end, -1 is returned.
+func (d *EntryDecoder) continuationEnd(data []byte, from int, complete bool) int {
+	nl := bytes.IndexByte(data[from:], '\n')
+	if nl < 0 {
+		return len(data)
+	}
+	for pos := from + nl + 1; pos < len(data); {
+		line := data[pos:]
+		next := len(data)
+		if nl := bytes.IndexByte(line, '\n'); nl >= 0 {
+			line, next = line[:nl], pos+nl+1
+		} else if !complete {
+			return -1
+		}
+		if !d.continuation.Match(line) {
+			return pos
+		}
+		pos = next
+	}
+	return len(data)
+}
+
+// nextHeader returns the offset of the header at or after from which begins
+// the entry after the one at the start of data, or -1 if there is none. With
+// IndentBlocks, headers on lines indented further than the first line of data
+// are skipped.
+func (d *EntryDecoder) nextHeader(data []byte, from int) int {
+	indent := lineIndent(data)
+	for pos := from; pos <= len(data); {
+		loc := d.findHeader(data[pos:])
+		if loc == nil {
+			return -1
+		}
+		start := pos + loc[0]
+		if !d.indentBlocks {
+			return start
+		}
+		lineStart := bytes.LastIndexByte(data[:start], '\n') + 1
+		if lineStart == 0 || lineIndent(data[lineStart:]) <= indent {
+			return start
+		}
+		// Resume the search on the next line.
+		nl := bytes.IndexByte(data[start:], '\n')
+		if nl < 0 {
+			return -1
+		}
+		pos = start + nl + 1
+	}
+	return -1
+}
+
+// lineIndent returns the number of spaces and tabs which begin b.
+func lineIndent(b []byte) int {
+	n := 0
+	for n < len(b) && (b[n] == ' ' || b[n] == '\t') {
+		n++
+	}
+	return n
+}
+
+// findHeader returns the location of the first header in data like
+// d.re.FindIndex. Most entries are a single line, so data usually either
+// begins with a header or has one at the start of its second line. If headers
+// can only begin at the start of a line, those two positions are checked with
+// the anchored pattern before resorting to searching the rest of data. This
+// saves scanning but not allocation: like FindIndex, each call allocates the
+// returned slice.
+func (d *EntryDecoder) findHeader(data []byte) []int {
+	if d.strict {
+		return d.findLineStartHeader(data)
+	}
+	if d.anchored == nil {
+		return d.re.FindIndex(data)
+	}
+	if loc := d.anchored.FindIndex(data); loc != nil {
+		return loc
+	}
+	nl := bytes.IndexByte(data, '\n')
+	if nl < 0 {
+		return nil
+	}
+	loc := d.anchored.FindIndex(data[nl+1:])
+	if loc == nil {
+		loc = d.re.FindIndex(data[nl+1:])
+	}
+	if loc != nil {
+		loc[0] += nl + 1
+		loc[1] += nl + 1
+	}
+	return loc
+}
+
+// findLineStartHeader is like findHeader but only finds headers which begin at
+// the start of a line.
+func (d *EntryDecoder) findLineStartHeader(data []byte) []int {
+	for pos := 0; pos < len(data); {
+		if loc := d.anchored.FindIndex(data[pos:]); loc != nil {
+			loc[0] += pos
+			loc[1] += pos
+			return loc
+		}
+		nl := bytes.IndexByte(data[pos:], '\n')
+		if nl < 0 {
+			return nil
+		}
+		pos += nl + 1
+	}
+	return nil
 }
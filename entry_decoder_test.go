@@ -0,0 +1,435 @@
+// Copyright 2018 Andrew Werner, All Rights Reserved.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testGlogPattern = regexp.MustCompile(presets["glog"].pattern)
+
+// decodeAll decodes every entry from in and returns them as header and
+// message pairs.
+func decodeAll(t testing.TB, d *EntryDecoder) [][2]string {
+	var entries [][2]string
+	for {
+		var e Entry
+		if err := d.Decode(&e); err == io.EOF {
+			return entries
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		entries = append(entries, [2]string{e.Header, e.Message})
+	}
+}
+
+func TestEntryDecoderSplit(t *testing.T) {
+	for _, c := range []struct {
+		name      string
+		in        string
+		unmatched bool
+		exp       [][2]string
+	}{
+		{
+			name: "single-line entries",
+			in: "n1> I181015 10:00:00.000001 1 foo.go:12 hello\n" +
+				"n1> W181015 10:00:00.000002 1 foo.go:13 warn\n",
+			exp: [][2]string{
+				{"n1> I181015 10:00:00.000001 1 foo.go:12", " hello\n"},
+				{"n1> W181015 10:00:00.000002 1 foo.go:13", " warn\n"},
+			},
+		},
+		{
+			name: "multi-line entry",
+			in: "n1> I181015 10:00:00.000001 1 foo.go:12 hello\n  continued\n  again\n" +
+				"n2> E181015 10:00:00.000003 bar.go:1 err\n",
+			exp: [][2]string{
+				{"n1> I181015 10:00:00.000001 1 foo.go:12", " hello\n  continued\n  again\n"},
+				{"n2> E181015 10:00:00.000003 bar.go:1", " err\n"},
+			},
+		},
+		{
+			name: "no trailing newline",
+			in:   "n1> I181015 10:00:00.000001 1 foo.go:12 hello",
+			exp: [][2]string{
+				{"n1> I181015 10:00:00.000001 1 foo.go:12", " hello"},
+			},
+		},
+		{
+			name: "leading text is dropped",
+			in:   "preamble\nn1> I181015 10:00:00.000001 1 foo.go:12 hello\n",
+			exp: [][2]string{
+				{"n1> I181015 10:00:00.000001 1 foo.go:12", " hello\n"},
+			},
+		},
+		{
+			name:      "leading text is kept",
+			in:        "preamble\nn1> I181015 10:00:00.000001 1 foo.go:12 hello\n",
+			unmatched: true,
+			exp: [][2]string{
+				{"", "preamble\n"},
+				{"n1> I181015 10:00:00.000001 1 foo.go:12", " hello\n"},
+			},
+		},
+		{
+			name: "crlf",
+			in: "n1> I181015 10:00:00.000001 1 foo.go:12 hello\r\n  more\r\n" +
+				"n1> I181015 10:00:00.000002 1 foo.go:13 bye\r\n",
+			exp: [][2]string{
+				{"n1> I181015 10:00:00.000001 1 foo.go:12", " hello\n  more\n"},
+				{"n1> I181015 10:00:00.000002 1 foo.go:13", " bye\n"},
+			},
+		},
+		{
+			name:      "crlf unmatched text",
+			in:        "preamble\r\nn1> I181015 10:00:00.000001 1 foo.go:12 hello\r",
+			unmatched: true,
+			exp: [][2]string{
+				{"", "preamble\n"},
+				{"n1> I181015 10:00:00.000001 1 foo.go:12", " hello"},
+			},
+		},
+		{
+			name: "header after a blank line",
+			in: "n1> I181015 10:00:00.000001 1 foo.go:12 hello\n\n" +
+				"n1> I181015 10:00:00.000002 1 foo.go:13 again\n",
+			exp: [][2]string{
+				{"n1> I181015 10:00:00.000001 1 foo.go:12", " hello\n\n"},
+				{"n1> I181015 10:00:00.000002 1 foo.go:13", " again\n"},
+			},
+		},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			// Decode with a buffer which holds the whole input and with one which
+			// must grow, so that entries span reads.
+			for _, size := range []int{4096, 16} {
+				d := NewEntryDecoderSize(testGlogPattern, strings.NewReader(c.in), size)
+				if c.unmatched {
+					d.KeepUnmatched()
+				}
+				got := decodeAll(t, d)
+				if len(got) != len(c.exp) {
+					t.Fatalf("size %d: got %q, expected %q", size, got, c.exp)
+				}
+				for i := range got {
+					if got[i] != c.exp[i] {
+						t.Fatalf("size %d: entry %d: got %q, expected %q", size, i, got[i], c.exp[i])
+					}
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkDecode(b *testing.B) {
+	for _, c := range []struct {
+		name  string
+		entry string
+	}{
+		{"single-line", "n1> I181015 10:00:00.000001 1 foo.go:12 a message of typical length\n"},
+		{"multi-line", "n1> E181015 10:00:00.000001 1 foo.go:12 a message\n  with\n  several\n  lines\n"},
+	} {
+		in := strings.Repeat(c.entry, 1000)
+		b.Run(c.name, func(b *testing.B) {
+			b.ReportAllocs()
+			b.SetBytes(int64(len(in)))
+			for i := 0; i < b.N; i++ {
+				d := NewEntryDecoder(testGlogPattern, strings.NewReader(in))
+				var e Entry
+				for d.Decode(&e) == nil {
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkFindSubmatchIndex measures the allocation made for each entry by
+// matching its header, which a pool of index buffers would avoid were the
+// regexp package to accept a caller-provided slice.
+func BenchmarkFindSubmatchIndex(b *testing.B) {
+	entry := []byte("n1> I181015 10:00:00.000001 1 foo.go:12 a message of typical length\n")
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		testGlogPattern.FindSubmatchIndex(entry)
+	}
+}
+
+// goroutineDump returns the trace of n goroutines as written by a Go panic.
+func goroutineDump(n int) string {
+	var b strings.Builder
+	for i := 1; i <= n; i++ {
+		fmt.Fprintf(&b, "goroutine %d [running]:\n", i)
+		fmt.Fprintf(&b, "main.worker(0x%x)\n\t/go/src/app/worker.go:%d +0x1d\n", i, 10+i)
+		b.WriteString("created by main.main\n\t/go/src/app/main.go:20 +0x5e\n\n")
+	}
+	return b.String()
+}
+
+func TestEntryDecoderStackTraces(t *testing.T) {
+	const (
+		first  = "n1> F181015 10:00:00.000001 1 main.go:30"
+		second = "n1> I181015 10:00:00.000002 1 main.go:31"
+	)
+	panicMsg := " panic: runtime error: index out of range [3] with length 3\n\n" +
+		"goroutine 1 [running]:\n" +
+		"main.main()\n\t/go/src/app/main.go:30 +0x1d\n" +
+		"exit status 2\n"
+	for _, c := range []struct {
+		name    string
+		message string
+		strict  bool
+	}{
+		{"panic", panicMsg, false},
+		{"goroutine dump", " dumping goroutines\n" + goroutineDump(3), false},
+		// The trace is longer than the initial read buffer, so it spans several
+		// reads.
+		{"trace spanning reads", " dumping goroutines\n" + goroutineDump(50), false},
+		// Only a strict decoder keeps an indented header in the message.
+		{"trace containing a header", " panic: bad entry\n\t" + second + " quoted\n" + goroutineDump(1), true},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			in := first + c.message + second + " after\n"
+			for _, size := range []int{4096, 64} {
+				d := NewEntryDecoderSize(testGlogPattern, strings.NewReader(in), size)
+				if c.strict {
+					d.Strict()
+				}
+				got := decodeAll(t, d)
+				exp := [][2]string{{first, c.message}, {second, " after\n"}}
+				if len(got) != len(exp) || got[0] != exp[0] || got[1] != exp[1] {
+					t.Fatalf("size %d: got %q, expected %q", size, got, exp)
+				}
+			}
+		})
+	}
+}
+
+func TestEntryDecoderContinuation(t *testing.T) {
+	const (
+		h1 = "n1> I181015 10:00:00.000001 1 foo.go:12"
+		h2 = "n1> I181015 10:00:00.000002 1 foo.go:13"
+	)
+	for _, c := range []struct {
+		name      string
+		in        string
+		unmatched bool
+		exp       [][2]string
+	}{
+		{
+			name: "every line continues",
+			in:   h1 + " a\n  b\n\tc\n" + h2 + " d\n",
+			exp:  [][2]string{{h1, " a\n  b\n\tc\n"}, {h2, " d\n"}},
+		},
+		{
+			name: "unmatched line is dropped",
+			in:   h1 + " a\n  b\nstray\n  indented\n" + h2 + " d\n",
+			exp:  [][2]string{{h1, " a\n  b\n"}, {h2, " d\n"}},
+		},
+		{
+			name:      "unmatched line is kept",
+			in:        h1 + " a\n  b\nstray\n  indented\n" + h2 + " d\n",
+			unmatched: true,
+			exp:       [][2]string{{h1, " a\n  b\n"}, {"", "stray\n  indented\n"}, {h2, " d\n"}},
+		},
+		{
+			name:      "first line does not continue",
+			in:        h1 + " a\nstray\n" + h2 + " d\n",
+			unmatched: true,
+			exp:       [][2]string{{h1, " a\n"}, {"", "stray\n"}, {h2, " d\n"}},
+		},
+		{
+			name:      "blank line does not continue",
+			in:        h1 + " a\n\n  b\n",
+			unmatched: true,
+			exp:       [][2]string{{h1, " a\n"}, {"", "\n  b\n"}},
+		},
+		{
+			name: "last line without a newline continues",
+			in:   h1 + " a\n  b",
+			exp:  [][2]string{{h1, " a\n  b"}},
+		},
+		{
+			name:      "last line without a newline does not continue",
+			in:        h1 + " a\n  b\nstray",
+			unmatched: true,
+			exp:       [][2]string{{h1, " a\n  b\n"}, {"", "stray"}},
+		},
+		{
+			name: "continuation spans reads",
+			in:   h1 + " a\n" + strings.Repeat("  more text\n", 20) + h2 + " d\n",
+			exp:  [][2]string{{h1, " a\n" + strings.Repeat("  more text\n", 20)}, {h2, " d\n"}},
+		},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			for _, size := range []int{4096, 16} {
+				d := NewEntryDecoderSize(testGlogPattern, strings.NewReader(c.in), size)
+				d.Continuation(regexp.MustCompile(`^\s`))
+				if c.unmatched {
+					d.KeepUnmatched()
+				}
+				if got := decodeAll(t, d); !reflect.DeepEqual(got, c.exp) {
+					t.Fatalf("size %d: got %q, expected %q", size, got, c.exp)
+				}
+			}
+		})
+	}
+}
+
+// testPythonPattern matches the headers of Python's logging module with a
+// format of "%(asctime)s %(levelname)s %(name)s: %(message)s".
+var testPythonPattern = regexp.MustCompile(`(?P<date>\d{4}-\d\d-\d\d \d\d:\d\d:\d\d,\d{3}) (?P<severity>[A-Z]+) (?P<prefix>\w+):`)
+
+func TestEntryDecoderIndentBlocks(t *testing.T) {
+	in, err := ioutil.ReadFile(filepath.Join("testdata", "traceback.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []struct {
+		indentBlocks bool
+		exp          []string
+	}{
+		{false, []string{
+			"2024-03-05 17:21:09,120 INFO worker:",
+			"2024-03-05 17:21:09,123 ERROR worker:",
+			"2024-03-05 17:21:08,001 INFO worker:",
+			"2024-03-05 17:21:09,130 WARNING worker:",
+			"2024-03-05 17:21:10,000 INFO worker:",
+			"2024-03-05 17:21:09,140 INFO worker:",
+		}},
+		// The headers quoted in the traceback and the YAML document are
+		// indented, so they remain in the messages of their entries.
+		{true, []string{
+			"2024-03-05 17:21:09,120 INFO worker:",
+			"2024-03-05 17:21:09,123 ERROR worker:",
+			"2024-03-05 17:21:09,130 WARNING worker:",
+			"2024-03-05 17:21:09,140 INFO worker:",
+		}},
+	} {
+		for _, size := range []int{4096, 32} {
+			d := NewEntryDecoderSize(testPythonPattern, bytes.NewReader(in), size)
+			if c.indentBlocks {
+				d.IndentBlocks()
+			}
+			var headers []string
+			var text strings.Builder
+			for _, e := range decodeAll(t, d) {
+				headers = append(headers, e[0])
+				text.WriteString(e[0] + e[1])
+			}
+			if !reflect.DeepEqual(headers, c.exp) {
+				t.Errorf("indent blocks %v, size %d: got headers %q, expected %q", c.indentBlocks, size, headers, c.exp)
+			}
+			if text.String() != string(in) {
+				t.Errorf("indent blocks %v, size %d: entries do not reproduce the input:\n%s", c.indentBlocks, size, text.String())
+			}
+		}
+	}
+}
+
+// slowReader is a reader which waits before each read, like a reader of a
+// high-latency network connection.
+type slowReader struct {
+	r     io.Reader
+	delay time.Duration
+}
+
+func (r slowReader) Read(p []byte) (int, error) {
+	time.Sleep(r.delay)
+	return r.r.Read(p)
+}
+
+// BenchmarkInputBufferSize measures the effect of -input-buffer-size when each
+// read of the input is slow.
+func BenchmarkInputBufferSize(b *testing.B) {
+	in := strings.Repeat("n1> I181015 10:00:00.000001 1 foo.go:12 a message of typical length\n", 4000)
+	for _, size := range []int{4096, 64 << 10} {
+		b.Run(strconv.Itoa(size), func(b *testing.B) {
+			b.SetBytes(int64(len(in)))
+			for i := 0; i < b.N; i++ {
+				r := slowReader{r: strings.NewReader(in), delay: 100 * time.Microsecond}
+				d := NewEntryDecoderSize(testGlogPattern, r, size)
+				var e Entry
+				for d.Decode(&e) == nil {
+				}
+			}
+		})
+	}
+}
+
+func TestEntryDecoderBoundary(t *testing.T) {
+	unanchored := regexp.MustCompile(`(?P<prefix>\[\w+\]) `)
+	for _, c := range []struct {
+		name    string
+		pattern *regexp.Regexp
+		in      string
+		lazy    [][2]string
+		strict  [][2]string
+	}{
+		{
+			name:    "header quoted mid-line",
+			pattern: testGlogPattern,
+			in: "n1> I181015 10:00:00.000001 1 foo.go:12 saw n2> I181015 10:00:00.000002 1 bar.go:1 in a message\n" +
+				"n1> I181015 10:00:00.000003 1 foo.go:13 next\n",
+			// The glog pattern is anchored to line starts, so it only begins
+			// entries there either way.
+			lazy: [][2]string{
+				{"n1> I181015 10:00:00.000001 1 foo.go:12", " saw n2> I181015 10:00:00.000002 1 bar.go:1 in a message\n"},
+				{"n1> I181015 10:00:00.000003 1 foo.go:13", " next\n"},
+			},
+			strict: [][2]string{
+				{"n1> I181015 10:00:00.000001 1 foo.go:12", " saw n2> I181015 10:00:00.000002 1 bar.go:1 in a message\n"},
+				{"n1> I181015 10:00:00.000003 1 foo.go:13", " next\n"},
+			},
+		},
+		{
+			name:    "unanchored pattern",
+			pattern: unanchored,
+			in:      "[a] first, see [b] for more\n[c] second\n",
+			lazy: [][2]string{
+				{"[a] ", "first, see "},
+				{"[b] ", "for more\n"},
+				{"[c] ", "second\n"},
+			},
+			strict: [][2]string{
+				{"[a] ", "first, see [b] for more\n"},
+				{"[c] ", "second\n"},
+			},
+		},
+		{
+			name:    "indented header",
+			pattern: unanchored,
+			in:      "[a] first\n  [b] indented\n",
+			lazy: [][2]string{
+				{"[a] ", "first\n  "},
+				{"[b] ", "indented\n"},
+			},
+			strict: [][2]string{
+				{"[a] ", "first\n  [b] indented\n"},
+			},
+		},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			for _, strict := range []bool{false, true} {
+				d := NewEntryDecoder(c.pattern, strings.NewReader(c.in))
+				exp := c.lazy
+				if strict {
+					d.Strict()
+					exp = c.strict
+				}
+				if got := decodeAll(t, d); !reflect.DeepEqual(got, exp) {
+					t.Errorf("strict=%v: got %q, expected %q", strict, got, exp)
+				}
+			}
+		})
+	}
+}
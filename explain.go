@@ -0,0 +1,102 @@
+// Copyright 2018 Andrew Werner, All Rights Reserved.
+
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/lucasb-eyer/go-colorful"
+	"github.com/wayneashleyberry/truecolor/pkg/color"
+)
+
+// explain writes a line to w describing how the color of the entry is chosen,
+// following the precedence of Color.
+func (le *LogEntry) explain(w io.Writer) {
+	var why string
+	text := le.Header + le.Message
+	if le.sessionColor != nil {
+		why = "colored by its -session-start session"
+	} else if c, ok := le.categories.find(text); ok {
+		why = fmt.Sprintf("colored by -category %s", c.spec)
+	} else if _, ok := le.exprColor(); ok {
+		why = "colored by the value of -color-by-expr"
+	} else if s := le.gradientValue(); s != "" {
+		why = fmt.Sprintf("colored by -severity-gradient value %q", s)
+	} else {
+		why = le.colors.explain(le.colorMapKey(), le.level())
+	}
+	fmt.Fprintf(w, "logcolor: entry at offset %d: %s\n", le.Offset, why)
+}
+
+// exprColor returns the color of the entry by -color-by-expr, if any.
+func (le *LogEntry) exprColor() (*color.Message, bool) {
+	if le.expr == nil {
+		return nil, false
+	}
+	return le.expr.color(le)
+}
+
+// gradientValue returns the numeric severity by which the entry is colored by
+// -severity-gradient, or the empty string if it is not.
+func (le *LogEntry) gradientValue() string {
+	if le.gradient == nil {
+		return ""
+	}
+	s, _ := le.Match(le.gradient.group)
+	if _, ok := le.gradient.color(s); !ok {
+		return ""
+	}
+	return s
+}
+
+// explain describes how the color of the key s for an entry of level l is
+// chosen.
+func (m *colorMap) explain(s string, l level) string {
+	if s == "" {
+		return "empty color key, given the neutral color #9e9e9e"
+	}
+	var b strings.Builder
+	tenant, key, hasTenant := splitTenantKey(s)
+	fmt.Fprintf(&b, "key %q", key)
+	if hasTenant {
+		fmt.Fprintf(&b, " of -hue-from tenant %q", tenant)
+	}
+	if t := m.truncateKey(s); t != s {
+		fmt.Fprintf(&b, " truncated by -color-key-length to %q", t)
+	}
+	if m.seed != "" {
+		b.WriteString(" seeded by -color-seed")
+	}
+	hashed := m.hashInput(s)
+	sum := keyHash(hashed)
+	fmt.Fprintf(&b, ", md5 %s", hex.EncodeToString(sum[:]))
+	var c colorful.Color
+	switch _, loaded := m.loaded[s]; {
+	case loaded:
+		c = m.keyColor(s)
+		b.WriteString(", color loaded by -load-color-map")
+	case m.pinTop > 0 && !m.isPinned(s):
+		h, _, _ := m.keyHCL(s)
+		c = colorful.Hcl(h, .05, .55).Clamped()
+		b.WriteString(", muted as it is not among the -pin-top keys")
+	case m.stableIndex:
+		c = m.keyColor(s)
+		fmt.Fprintf(&b, ", -stable-index palette index %d", stableIndex(hashed))
+	default:
+		if m.ring != nil {
+			b.WriteString(", hue from -color-ring")
+		}
+		h, ch, lum := m.keyHCL(s)
+		fmt.Fprintf(&b, ", hcl(%.1f, %.3f, %.3f)", h, ch, lum)
+		if lh, lc, ll := m.levelHCL(s, l); lc != ch || ll != lum {
+			fmt.Fprintf(&b, " adjusted for level to hcl(%.1f, %.3f, %.3f)", lh, lc, ll)
+			h, ch, lum = lh, lc, ll
+		}
+		c = colorful.Hcl(h, ch, lum).Clamped()
+	}
+	fmt.Fprintf(&b, ", rgb %s", c.Hex())
+	return b.String()
+}
@@ -0,0 +1,206 @@
+// Copyright 2018 Andrew Werner, All Rights Reserved.
+
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/lucasb-eyer/go-colorful"
+	"github.com/wayneashleyberry/truecolor/pkg/color"
+)
+
+// colorExpr colors entries by the value of an arithmetic expression over their
+// captures, mapped onto a gradient from green at low to red at high.
+type colorExpr struct {
+	eval      exprFunc
+	names     []string
+	low, high float64
+	colors    map[int]*color.Message
+}
+
+// exprFunc evaluates an expression given a function which returns the
+// numeric value of a capture. The result is false if a capture is not a
+// number or the expression divides by zero.
+type exprFunc func(capture func(string) (float64, bool)) (float64, bool)
+
+// gradientSteps is the number of distinct colors in the gradient.
+const gradientSteps = 64
+
+// parseColorExpr parses an expression of numbers, capture group names,
+// parentheses and the operators +, -, * and /.
+func parseColorExpr(s string, low, high float64) (*colorExpr, error) {
+	p := &exprParser{s: s}
+	eval, err := p.parseSum()
+	if err == nil && p.peek() != 0 {
+		err = fmt.Errorf("unexpected %q", p.s[p.pos:])
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid expression %q: %v", s, err)
+	}
+	return &colorExpr{
+		eval:   eval,
+		names:  p.names,
+		low:    low,
+		high:   high,
+		colors: map[int]*color.Message{},
+	}, nil
+}
+
+// color returns the color of the entry, or false if the expression has no
+// value for it.
+func (e *colorExpr) color(le *LogEntry) (*color.Message, bool) {
+	v, ok := e.eval(func(name string) (float64, bool) {
+		s, _ := le.Match(name)
+		f, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+		return f, err == nil
+	})
+	if !ok || math.IsNaN(v) {
+		return nil, false
+	}
+	t := 0.0
+	if e.high > e.low {
+		t = math.Max(0, math.Min(1, (v-e.low)/(e.high-e.low)))
+	}
+	step := int(t * (gradientSteps - 1))
+	if col, ok := e.colors[step]; ok {
+		return col, true
+	}
+	h := 130 * (1 - float64(step)/(gradientSteps-1))
+	col := color.Color(colorful.Hcl(h, .5, .7).Clamped().RGB255())
+	e.colors[step] = col
+	return col, true
+}
+
+type exprParser struct {
+	s     string
+	pos   int
+	names []string
+}
+
+func (p *exprParser) skipSpace() {
+	for p.pos < len(p.s) && p.s[p.pos] == ' ' {
+		p.pos++
+	}
+}
+
+// peek returns the next non-space byte, or 0 at the end of the expression.
+func (p *exprParser) peek() byte {
+	p.skipSpace()
+	if p.pos == len(p.s) {
+		return 0
+	}
+	return p.s[p.pos]
+}
+
+func (p *exprParser) parseSum() (exprFunc, error) {
+	l, err := p.parseProduct()
+	if err != nil {
+		return nil, err
+	}
+	for op := p.peek(); op == '+' || op == '-'; op = p.peek() {
+		p.pos++
+		r, err := p.parseProduct()
+		if err != nil {
+			return nil, err
+		}
+		l = binaryExpr(op, l, r)
+	}
+	return l, nil
+}
+
+func (p *exprParser) parseProduct() (exprFunc, error) {
+	l, err := p.parseFactor()
+	if err != nil {
+		return nil, err
+	}
+	for op := p.peek(); op == '*' || op == '/'; op = p.peek() {
+		p.pos++
+		r, err := p.parseFactor()
+		if err != nil {
+			return nil, err
+		}
+		l = binaryExpr(op, l, r)
+	}
+	return l, nil
+}
+
+func (p *exprParser) parseFactor() (exprFunc, error) {
+	switch c := p.peek(); {
+	case c == 0:
+		return nil, fmt.Errorf("unexpected end")
+	case c == '-':
+		p.pos++
+		f, err := p.parseFactor()
+		if err != nil {
+			return nil, err
+		}
+		return binaryExpr('-', constExpr(0), f), nil
+	case c == '(':
+		p.pos++
+		f, err := p.parseSum()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek() != ')' {
+			return nil, fmt.Errorf("missing )")
+		}
+		p.pos++
+		return f, nil
+	case c == '.' || (c >= '0' && c <= '9'):
+		start := p.pos
+		for p.pos < len(p.s) && (p.s[p.pos] == '.' || (p.s[p.pos] >= '0' && p.s[p.pos] <= '9')) {
+			p.pos++
+		}
+		v, err := strconv.ParseFloat(p.s[start:p.pos], 64)
+		if err != nil {
+			return nil, err
+		}
+		return constExpr(v), nil
+	case c == '_' || unicode.IsLetter(rune(c)):
+		start := p.pos
+		for p.pos < len(p.s) && (p.s[p.pos] == '_' || unicode.IsLetter(rune(p.s[p.pos])) || unicode.IsDigit(rune(p.s[p.pos]))) {
+			p.pos++
+		}
+		name := p.s[start:p.pos]
+		p.names = append(p.names, name)
+		return func(capture func(string) (float64, bool)) (float64, bool) {
+			return capture(name)
+		}, nil
+	default:
+		return nil, fmt.Errorf("unexpected %q", p.s[p.pos:])
+	}
+}
+
+func constExpr(v float64) exprFunc {
+	return func(func(string) (float64, bool)) (float64, bool) { return v, true }
+}
+
+func binaryExpr(op byte, l, r exprFunc) exprFunc {
+	return func(capture func(string) (float64, bool)) (float64, bool) {
+		a, ok := l(capture)
+		if !ok {
+			return 0, false
+		}
+		b, ok := r(capture)
+		if !ok {
+			return 0, false
+		}
+		switch op {
+		case '+':
+			return a + b, true
+		case '-':
+			return a - b, true
+		case '*':
+			return a * b, true
+		default:
+			if b == 0 {
+				return 0, false
+			}
+			return a / b, true
+		}
+	}
+}
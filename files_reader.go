@@ -0,0 +1,49 @@
+// Copyright 2018 Andrew Werner, All Rights Reserved.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+// NewFilesReader returns a reader of the concatenated contents of the files at
+// paths, like cat. Each file is opened when the previous one has been read to
+// its end and is closed once it has been read.
+func NewFilesReader(paths []string) io.Reader {
+	return &filesReader{paths: paths}
+}
+
+type filesReader struct {
+	paths []string
+	f     *os.File
+}
+
+func (r *filesReader) Read(buf []byte) (int, error) {
+	for {
+		if r.f == nil {
+			if len(r.paths) == 0 {
+				return 0, io.EOF
+			}
+			f, err := os.Open(r.paths[0])
+			if err != nil {
+				return 0, err
+			}
+			r.f = f
+		}
+		n, err := r.f.Read(buf)
+		if err == io.EOF {
+			r.f.Close()
+			r.f, r.paths = nil, r.paths[1:]
+			if n == 0 {
+				continue
+			}
+			err = nil
+		}
+		if err != nil {
+			err = fmt.Errorf("%s: %v", r.paths[0], err)
+		}
+		return n, err
+	}
+}
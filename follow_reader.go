@@ -0,0 +1,118 @@
+// Copyright 2018 Andrew Werner, All Rights Reserved.
+
+package main
+
+import (
+	"io"
+	"os"
+	"time"
+)
+
+// NewFollowReader returns a reader which follows the file at path by name in
+// the manner of tail -F. Rather than returning io.EOF when it reaches the end
+// of the file it polls every pollInterval for more data. If the file at path
+// is replaced, as happens when a log is rotated, the remainder of the old file
+// is read and then the new file is read from its beginning. If the file is
+// truncated it is read again from the beginning.
+func NewFollowReader(path string, pollInterval time.Duration) (io.Reader, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &followReader{
+		path:   path,
+		poll:   pollInterval,
+		byName: true,
+		f:      f,
+		fi:     fi,
+	}, nil
+}
+
+// NewTailReader is like NewFollowReader but follows the file it opens in the
+// manner of tail -f, reading data appended to it until it is closed, even if
+// it is renamed or replaced at path.
+func NewTailReader(path string, pollInterval time.Duration) (io.Reader, error) {
+	r, err := NewFollowReader(path, pollInterval)
+	if err != nil {
+		return nil, err
+	}
+	r.(*followReader).byName = false
+	return r, nil
+}
+
+type followReader struct {
+	path   string
+	poll   time.Duration
+	byName bool
+	f      *os.File
+	fi     os.FileInfo
+	offset int64
+	// next is the file which replaced f, which is read once f has been read
+	// to its end.
+	next   *os.File
+	nextFi os.FileInfo
+}
+
+func (r *followReader) Read(buf []byte) (n int, err error) {
+	for {
+		n, err = r.f.Read(buf)
+		r.offset += int64(n)
+		if err != io.EOF {
+			return n, err
+		}
+		if r.next != nil {
+			r.f.Close()
+			r.f, r.fi, r.offset = r.next, r.nextFi, 0
+			r.next, r.nextFi = nil, nil
+			continue
+		}
+		reopened, err := r.reopenIfRotated()
+		if err != nil {
+			return 0, err
+		}
+		if !reopened {
+			time.Sleep(r.poll)
+		}
+	}
+}
+
+// reopenIfRotated is called when the current file has been read to its end.
+// It detects whether the file at r.path has been replaced, if the reader
+// follows the file by name, or whether the file has been truncated and
+// repositions the reader accordingly, returning true if it did so.
+func (r *followReader) reopenIfRotated() (bool, error) {
+	stat := func() (os.FileInfo, error) { return os.Stat(r.path) }
+	if !r.byName {
+		stat = r.f.Stat
+	}
+	fi, err := stat()
+	if err != nil {
+		// The file may be missing briefly in the middle of a rotation; keep
+		// waiting for it to reappear.
+		return false, nil
+	}
+	if !os.SameFile(fi, r.fi) {
+		f, err := os.Open(r.path)
+		if err != nil {
+			return false, nil
+		}
+		// Data may have been written to the old file between the read which
+		// reached its end and its replacement, so it is read to its end once
+		// more before the new file is read.
+		r.next, r.nextFi = f, fi
+		return true, nil
+	}
+	if fi.Size() < r.offset {
+		if _, err := r.f.Seek(0, io.SeekStart); err != nil {
+			return false, err
+		}
+		r.offset = 0
+		return true, nil
+	}
+	return false, nil
+}
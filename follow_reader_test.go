@@ -0,0 +1,140 @@
+// Copyright 2018 Andrew Werner, All Rights Reserved.
+
+package main
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFollowReaderRotation(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+	appendLine := func(path, line string) {
+		t.Helper()
+		f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		if _, err := f.WriteString(line + "\n"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	appendLine(path, "a")
+	r, err := NewFollowReader(path, 20*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := make(chan string)
+	go func() {
+		s := bufio.NewScanner(r)
+		for s.Scan() {
+			lines <- s.Text()
+		}
+	}()
+	expect := func(want string) {
+		t.Helper()
+		select {
+		case got := <-lines:
+			if got != want {
+				t.Fatalf("got line %q, expected %q", got, want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for line %q", want)
+		}
+	}
+	expect("a")
+	// Let the reader reach the end of the file and poll before a line is
+	// written just ahead of the rotation, which it must not lose.
+	time.Sleep(50 * time.Millisecond)
+	appendLine(path, "b")
+	if err := os.Rename(path, path+".1"); err != nil {
+		t.Fatal(err)
+	}
+	appendLine(path, "c")
+	expect("b")
+	expect("c")
+	appendLine(path, "d")
+	expect("d")
+	select {
+	case got := <-lines:
+		t.Fatalf("unexpected line %q", got)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestFollowReaderTruncation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	if err := os.WriteFile(path, []byte("first line\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	r, err := NewFollowReader(path, 10*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := bufio.NewScanner(r)
+	if !s.Scan() || s.Text() != "first line" {
+		t.Fatalf("got %q, expected %q", s.Text(), "first line")
+	}
+	time.Sleep(30 * time.Millisecond)
+	if err := os.WriteFile(path, []byte("x\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if !s.Scan() || s.Text() != "x" {
+		t.Fatalf("got %q after truncation, expected %q", s.Text(), "x")
+	}
+}
+
+// TestFollowReaderDrainsReplacedFile checks that data written to a file just
+// before it is replaced, after the reader last reached its end, is read before
+// the file which replaced it.
+func TestFollowReaderDrainsReplacedFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	if err := os.WriteFile(path, []byte("a\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	r, err := NewFollowReader(path, time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fr := r.(*followReader)
+	buf := make([]byte, 64)
+	if n, _ := fr.f.Read(buf); string(buf[:n]) != "a\n" {
+		t.Fatalf("got %q, expected %q", buf[:n], "a\n")
+	}
+	// Between the read which reached the end and the check for rotation, the
+	// old file is appended to and replaced.
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.WriteString("b\n"); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	if err := os.Rename(path, path+".1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte("c\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if reopened, err := fr.reopenIfRotated(); err != nil || !reopened {
+		t.Fatalf("reopenIfRotated() = %v, %v, expected true", reopened, err)
+	}
+	const want = "b\nc\n"
+	var got string
+	for len(got) < len(want) {
+		n, err := r.Read(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got += string(buf[:n]); !strings.HasPrefix(want, got) {
+			t.Fatalf("got %q, expected %q", got, want)
+		}
+	}
+}
@@ -1,6 +1,9 @@
 module github.com/ajwerner/logcolor
 
 require (
+	github.com/itchyny/gojq v0.12.13
 	github.com/lucasb-eyer/go-colorful v0.0.0-20181028223441-12d3b2882a08
 	github.com/wayneashleyberry/truecolor v1.0.0
+	golang.org/x/term v0.8.0
+	golang.org/x/text v0.3.7
 )
@@ -0,0 +1,85 @@
+// Copyright 2018 Andrew Werner, All Rights Reserved.
+
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/lucasb-eyer/go-colorful"
+	"github.com/wayneashleyberry/truecolor/pkg/color"
+)
+
+// severityGradient colors entries by a numeric severity on a discrete scale
+// for -severity-gradient. A value below the first threshold is given the first
+// color, and a value at or above threshold i is given color i+1, so that
+// values beyond the thresholds take the color of the nearest band.
+type severityGradient struct {
+	group      string
+	thresholds []float64
+	colors     []*color.Message
+}
+
+// parseSeverityGradient parses a gradient given as
+// GROUP:T1,T2,...:#rrggbb,#rrggbb,... with ascending thresholds and one more
+// color than there are thresholds.
+func parseSeverityGradient(spec string) (*severityGradient, error) {
+	parts := strings.Split(spec, ":")
+	if len(parts) != 3 || parts[0] == "" {
+		return nil, fmt.Errorf("invalid severity gradient %q, expected GROUP:THRESHOLDS:COLORS", spec)
+	}
+	g := &severityGradient{group: parts[0]}
+	for _, t := range strings.Split(parts[1], ",") {
+		f, err := strconv.ParseFloat(t, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid severity gradient %q: threshold %q is not a number", spec, t)
+		}
+		if n := len(g.thresholds); n > 0 && f <= g.thresholds[n-1] {
+			return nil, fmt.Errorf("invalid severity gradient %q: thresholds must ascend", spec)
+		}
+		g.thresholds = append(g.thresholds, f)
+	}
+	for _, h := range strings.Split(parts[2], ",") {
+		c, err := colorful.Hex(h)
+		if err != nil {
+			return nil, fmt.Errorf("invalid severity gradient %q: %v", spec, err)
+		}
+		g.colors = append(g.colors, color.Color(c.RGB255()))
+	}
+	if len(g.colors) != len(g.thresholds)+1 {
+		return nil, fmt.Errorf("invalid severity gradient %q: %d thresholds require %d colors",
+			spec, len(g.thresholds), len(g.thresholds)+1)
+	}
+	return g, nil
+}
+
+// color returns the color of the band of the numeric severity s, or false if
+// s is not a number.
+func (g *severityGradient) color(s string) (*color.Message, bool) {
+	v, err := strconv.ParseFloat(strings.TrimSpace(stripEscapes(s)), 64)
+	if err != nil {
+		return nil, false
+	}
+	if noColor {
+		return plainColor, true
+	}
+	i := sort.Search(len(g.thresholds), func(i int) bool { return v < g.thresholds[i] })
+	return g.colors[i], true
+}
+
+// templateColor is the color template function for the gradient. Values which
+// are not numbers, and all values if there is no gradient, are given the
+// neutral color.
+func (g *severityGradient) templateColor(s string) *color.Message {
+	if g != nil {
+		if col, ok := g.color(s); ok {
+			return col
+		}
+	}
+	if noColor {
+		return plainColor
+	}
+	return neutralColor
+}
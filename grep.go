@@ -0,0 +1,109 @@
+// Copyright 2018 Andrew Werner, All Rights Reserved.
+
+package main
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// regexpFlag is a flag which may be repeated to give several regular
+// expressions.
+type regexpFlag []*regexp.Regexp
+
+func (f *regexpFlag) String() string {
+	res := make([]string, len(*f))
+	for i, re := range *f {
+		res[i] = re.String()
+	}
+	return strings.Join(res, " ")
+}
+
+func (f *regexpFlag) Set(s string) error {
+	re, err := regexp.Compile(s)
+	if err != nil {
+		return err
+	}
+	*f = append(*f, re)
+	return nil
+}
+
+// grepMatches returns true if text matches every regexp of include and none
+// of exclude.
+func grepMatches(text string, include, exclude regexpFlag) bool {
+	for _, re := range include {
+		if !re.MatchString(text) {
+			return false
+		}
+	}
+	for _, re := range exclude {
+		if re.MatchString(text) {
+			return false
+		}
+	}
+	return true
+}
+
+// SGR escape sequences which highlight the matches of -highlight in bold
+// reverse video.
+const (
+	sgrHighlight   = "\x1b[1;7m"
+	sgrNoHighlight = "\x1b[22;27m"
+)
+
+// highlightMatches highlights the text of s matched by any of res. Matches
+// which overlap are merged, and those which overlap an escape sequence already
+// in s are skipped so that it is not broken up.
+func highlightMatches(s string, res regexpFlag) string {
+	if noColor || len(res) == 0 {
+		return s
+	}
+	var escapes [][2]int
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\x1b' {
+			n := escapeLen(s[i:])
+			escapes = append(escapes, [2]int{i, i + n})
+			i += n - 1
+		}
+	}
+	var spans [][]int
+	for _, re := range res {
+		for _, m := range re.FindAllStringIndex(s, -1) {
+			if m[0] < m[1] && !overlapsAny(m, escapes) {
+				spans = append(spans, m)
+			}
+		}
+	}
+	if len(spans) == 0 {
+		return s
+	}
+	sort.Slice(spans, func(i, j int) bool { return spans[i][0] < spans[j][0] })
+	var b strings.Builder
+	last := 0
+	for i := 0; i < len(spans); {
+		start, end := spans[i][0], spans[i][1]
+		for i++; i < len(spans) && spans[i][0] <= end; i++ {
+			if spans[i][1] > end {
+				end = spans[i][1]
+			}
+		}
+		b.WriteString(s[last:start])
+		b.WriteString(sgrHighlight)
+		b.WriteString(s[start:end])
+		b.WriteString(sgrNoHighlight)
+		last = end
+	}
+	b.WriteString(s[last:])
+	return b.String()
+}
+
+// overlapsAny returns true if the span m overlaps any of spans.
+func overlapsAny(m []int, spans [][2]int) bool {
+	for _, sp := range spans {
+		if m[0] < sp[1] && sp[0] < m[1] {
+			return true
+		}
+	}
+	return false
+}
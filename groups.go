@@ -0,0 +1,56 @@
+// Copyright 2018 Andrew Werner, All Rights Reserved.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/wayneashleyberry/truecolor/pkg/color"
+)
+
+// keyGroups buffers rendered entries by their color key so that they can be
+// written grouped by key once the input ends. It holds every entry in memory.
+type keyGroups struct {
+	keys    []string
+	entries map[string][][]byte
+}
+
+func newKeyGroups() *keyGroups {
+	return &keyGroups{entries: map[string][][]byte{}}
+}
+
+// add buffers a copy of the rendered entry.
+func (g *keyGroups) add(key string, rendered []byte) {
+	if _, ok := g.entries[key]; !ok {
+		g.keys = append(g.keys, key)
+	}
+	g.entries[key] = append(g.entries[key], append([]byte(nil), rendered...))
+}
+
+// write writes the entries of each key under a header naming the key, in the
+// order in which the keys were first seen.
+func (g *keyGroups) write(w io.Writer, getColor func(string) *color.Message) error {
+	for i, key := range g.keys {
+		if i > 0 {
+			if _, err := io.WriteString(w, "\n"); err != nil {
+				return err
+			}
+		}
+		name := strings.TrimSpace(key)
+		if name == "" {
+			name = "(no key)"
+		}
+		entries := g.entries[key]
+		if _, err := fmt.Fprintf(w, "%s (%d)\n", getColor(key).Sprint("== "+name+" =="), len(entries)); err != nil {
+			return err
+		}
+		for _, e := range entries {
+			if _, err := w.Write(e); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,224 @@
+// Copyright 2018 Andrew Werner, All Rights Reserved.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// htmlWriter is a writer which converts text colored with SGR escape
+// sequences into a standalone HTML document for -output-format html. Colored
+// text is written as spans styled with CSS, and other escape sequences are
+// dropped.
+type htmlWriter struct {
+	w io.Writer
+	sgrScanner
+	// open is the style of the span which is open, if any.
+	open htmlStyle
+	buf  bytes.Buffer
+}
+
+// sgrScanner tracks the style set by SGR escape sequences in text which is
+// written to it in pieces.
+type sgrScanner struct {
+	// style is that set by the escape sequences scanned so far.
+	style htmlStyle
+	// pending holds an escape sequence which was split between writes.
+	pending []byte
+}
+
+// scan calls text with each run of text in b which is not an escape sequence,
+// updating the style as escape sequences are passed.
+func (s *sgrScanner) scan(b []byte, text func([]byte)) {
+	if len(s.pending) > 0 {
+		b = append(s.pending, b...)
+		s.pending = nil
+	}
+	for len(b) > 0 {
+		i := bytes.IndexByte(b, '\x1b')
+		if i < 0 {
+			text(b)
+			return
+		}
+		if i > 0 {
+			text(b[:i])
+		}
+		b = b[i:]
+		l := escapeLen(string(b))
+		if l == len(b) && !escapeComplete(b) {
+			s.pending = append([]byte(nil), b...)
+			return
+		}
+		if l >= 3 && b[1] == '[' && b[l-1] == 'm' {
+			s.style.apply(string(b[2 : l-1]))
+		}
+		b = b[l:]
+	}
+}
+
+type htmlStyle struct {
+	fg, bg                       string
+	bold, dim, italic, underline bool
+}
+
+func (s htmlStyle) css() string {
+	var props []string
+	if s.fg != "" {
+		props = append(props, "color:"+s.fg)
+	}
+	if s.bg != "" {
+		props = append(props, "background-color:"+s.bg)
+	}
+	if s.bold {
+		props = append(props, "font-weight:bold")
+	}
+	if s.dim {
+		props = append(props, "opacity:.6")
+	}
+	if s.italic {
+		props = append(props, "font-style:italic")
+	}
+	if s.underline {
+		props = append(props, "text-decoration:underline")
+	}
+	return strings.Join(props, ";")
+}
+
+// htmlThemes are the page styles of the dark and light backgrounds.
+var htmlThemes = map[string]string{
+	"dark":  "background:#1e1e1e;color:#d4d4d4",
+	"light": "background:#ffffff;color:#1e1e1e",
+}
+
+// newHTMLWriter returns an htmlWriter which writes to w with the page style
+// of the given theme, one of htmlThemes.
+func newHTMLWriter(w io.Writer, theme string) (*htmlWriter, error) {
+	_, err := fmt.Fprintf(w, `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<style>body{margin:0;%s}pre{margin:0;padding:1em;font-family:monospace;white-space:pre-wrap}</style>
+</head>
+<body>
+<pre>`, htmlThemes[theme])
+	return &htmlWriter{w: w}, err
+}
+
+func (hw *htmlWriter) Write(b []byte) (int, error) {
+	hw.buf.Reset()
+	hw.scan(b, hw.text)
+	if _, err := hw.w.Write(hw.buf.Bytes()); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// escapeComplete returns true if b holds a whole control sequence.
+func escapeComplete(b []byte) bool {
+	if len(b) < 2 {
+		return false
+	}
+	if b[1] != '[' {
+		return true
+	}
+	for _, c := range b[2:] {
+		if c >= 0x40 && c <= 0x7e {
+			return true
+		}
+	}
+	return false
+}
+
+// text writes t in the current style.
+func (hw *htmlWriter) text(t []byte) {
+	if len(t) == 0 {
+		return
+	}
+	if hw.style != hw.open {
+		if hw.open != (htmlStyle{}) {
+			hw.buf.WriteString("</span>")
+		}
+		if hw.style != (htmlStyle{}) {
+			fmt.Fprintf(&hw.buf, `<span style="%s">`, hw.style.css())
+		}
+		hw.open = hw.style
+	}
+	hw.buf.WriteString(html.EscapeString(string(t)))
+}
+
+// close ends the document.
+func (hw *htmlWriter) close() error {
+	end := "</pre>\n</body>\n</html>\n"
+	if hw.open != (htmlStyle{}) {
+		end = "</span>" + end
+	}
+	_, err := io.WriteString(hw.w, end)
+	return err
+}
+
+// apply updates s with the semicolon-separated SGR parameters params.
+func (s *htmlStyle) apply(params string) {
+	ps := strings.Split(params, ";")
+	for i := 0; i < len(ps); i++ {
+		switch p, _ := strconv.Atoi(ps[i]); {
+		case p == 0:
+			*s = htmlStyle{}
+		case p == 1:
+			s.bold = true
+		case p == 2:
+			s.dim = true
+		case p == 3:
+			s.italic = true
+		case p == 4:
+			s.underline = true
+		case p == 22:
+			s.bold, s.dim = false, false
+		case p == 23:
+			s.italic = false
+		case p == 24:
+			s.underline = false
+		case p >= 30 && p <= 37:
+			s.fg = paletteHex(p - 30)
+		case p >= 90 && p <= 97:
+			s.fg = paletteHex(p - 90 + 8)
+		case p >= 40 && p <= 47:
+			s.bg = paletteHex(p - 40)
+		case p >= 100 && p <= 107:
+			s.bg = paletteHex(p - 100 + 8)
+		case p == 39:
+			s.fg = ""
+		case p == 49:
+			s.bg = ""
+		case p == 38 || p == 48:
+			var c string
+			c, i = extendedColor(ps, i)
+			if p == 38 {
+				s.fg = c
+			} else {
+				s.bg = c
+			}
+		}
+	}
+}
+
+// extendedColor parses the color of the 38 or 48 parameter at ps[i], either
+// 5;N or 2;R;G;B, and returns it along with the index of its last parameter.
+func extendedColor(ps []string, i int) (string, int) {
+	if i+2 < len(ps) && ps[i+1] == "5" {
+		n, _ := strconv.Atoi(ps[i+2])
+		return paletteHex(n), i + 2
+	}
+	if i+4 < len(ps) && ps[i+1] == "2" {
+		var rgb [3]int
+		for j := range rgb {
+			rgb[j], _ = strconv.Atoi(ps[i+2+j])
+		}
+		return fmt.Sprintf("#%02x%02x%02x", rgb[0]&0xff, rgb[1]&0xff, rgb[2]&0xff), i + 4
+	}
+	return "", len(ps)
+}
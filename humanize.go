@@ -0,0 +1,98 @@
+// Copyright 2018 Andrew Werner, All Rights Reserved.
+
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// humanBytes renders a count of bytes with binary units, such as 1.2 GiB.
+// Surrounding space is ignored and strings which are not numbers are returned
+// unchanged.
+func humanBytes(s string) string {
+	n, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	if err != nil {
+		return s
+	}
+	const units = "KMGTPE"
+	if n < 1024 && n > -1024 {
+		return fmt.Sprintf("%v B", n)
+	}
+	i := -1
+	for ; (n >= 1024 || n <= -1024) && i < len(units)-1; i++ {
+		n /= 1024
+	}
+	return fmt.Sprintf("%.1f %ciB", n, units[i])
+}
+
+// humanDuration renders a number of nanoseconds as a duration with three
+// significant digits, such as 3.4ms. Like humanBytes, surrounding space is
+// ignored and strings which are not numbers are returned unchanged.
+func humanDuration(s string) string {
+	n, err := strconv.ParseInt(strings.TrimSpace(s), 10, 64)
+	if err != nil {
+		return s
+	}
+	d := time.Duration(n)
+	for r := time.Duration(1); r < time.Hour; r *= 10 {
+		if d < 1000*r && d > -1000*r {
+			return d.Round(r).String()
+		}
+	}
+	return d.Round(time.Second).String()
+}
+
+// parseTime parses s with layout, or with any of timestampLayouts if layout
+// is empty, as a time in the local time zone unless s specifies one. Strings
+// which cannot be parsed are returned unchanged, so that the template can
+// still write them.
+func parseTime(layout, s string) interface{} {
+	layouts := timestampLayouts
+	if layout != "" {
+		layouts = []string{layout}
+	}
+	for _, l := range layouts {
+		if t, err := time.ParseInLocation(l, strings.TrimSpace(s), time.Local); err == nil {
+			return t
+		}
+	}
+	return s
+}
+
+// timeFormat formats t, a time.Time returned by parseTime, with layout. The
+// layout "relative" renders t relative to the current time, such as 5s ago.
+// Anything other than a time.Time is formatted with %v, so that the strings
+// parseTime fails to parse are passed through.
+func timeFormat(layout string, t interface{}) string {
+	tt, ok := t.(time.Time)
+	if !ok {
+		return fmt.Sprint(t)
+	}
+	if layout == "relative" {
+		return relativeTime(time.Since(tt))
+	}
+	return tt.Format(layout)
+}
+
+// relativeTime renders the time d before now in its largest whole unit, such
+// as 5s ago, or as in 5s if d is negative.
+func relativeTime(d time.Duration) string {
+	format := "%d%s ago"
+	if d < 0 {
+		d, format = -d, "in %d%s"
+	}
+	switch {
+	case d < time.Second:
+		return "now"
+	case d < time.Minute:
+		return fmt.Sprintf(format, d/time.Second, "s")
+	case d < time.Hour:
+		return fmt.Sprintf(format, d/time.Minute, "m")
+	case d < 24*time.Hour:
+		return fmt.Sprintf(format, d/time.Hour, "h")
+	}
+	return fmt.Sprintf(format, d/(24*time.Hour), "d")
+}
@@ -0,0 +1,34 @@
+// Copyright 2018 Andrew Werner, All Rights Reserved.
+
+//go:build jq
+// +build jq
+
+package main
+
+import "github.com/itchyny/gojq"
+
+func init() {
+	compileJQ = compileGojq
+}
+
+// compileGojq compiles a jq expression with gojq.
+func compileGojq(expr string) (jqTransform, error) {
+	q, err := gojq.Parse(expr)
+	if err != nil {
+		return nil, err
+	}
+	code, err := gojq.Compile(q)
+	if err != nil {
+		return nil, err
+	}
+	return func(fields map[string]interface{}) (interface{}, bool, error) {
+		v, ok := code.Run(fields).Next()
+		if !ok {
+			return nil, false, nil
+		}
+		if err, isErr := v.(error); isErr {
+			return nil, false, err
+		}
+		return v, true, nil
+	}, nil
+}
@@ -0,0 +1,53 @@
+// Copyright 2018 Andrew Werner, All Rights Reserved.
+
+//go:build jq
+// +build jq
+
+package main
+
+import (
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestJQTransform(t *testing.T) {
+	in := `{"msg":"login","user":{"id":7,"name":"ann"},"level":"info"}` + "\n" +
+		`{"msg":"health check","user":null,"level":"debug"}` + "\n" +
+		`{"msg":"logout","user":{"id":8,"name":"bob"},"level":"info","tags":["a","b"]}` + "\n"
+	for _, c := range []struct {
+		name  string
+		expr  string
+		field string
+		exp   []string
+	}{
+		{"identity", ".", "msg", []string{"login", "health check", "logout"}},
+		{"nested field", ".user.name", "msg", []string{"ann", "bob"}},
+		{"construct object", "{msg, key: .user.id}", "key", []string{"7", "", "8"}},
+		{"select", "select(.level != \"debug\")", "msg", []string{"login", "logout"}},
+		{"array", "{msg: (.tags // [] | join(\",\"))}", "msg", []string{"", "", "a,b"}},
+		{"failing expression leaves entry", ".msg + 1", "msg", []string{"login", "health check", "logout"}},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			tr, err := compileJQ(c.expr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			d := NewJSONDecoderSize(strings.NewReader(in), 4096)
+			d.Transform(tr)
+			var got []string
+			for {
+				le := LogEntry{}
+				if err := d.Decode(&le.Entry); err == io.EOF {
+					break
+				} else if err != nil {
+					t.Fatal(err)
+				}
+				got = append(got, le.Field(c.field))
+			}
+			if strings.Join(got, "|") != strings.Join(c.exp, "|") {
+				t.Fatalf("got %q, expected %q", got, c.exp)
+			}
+		})
+	}
+}
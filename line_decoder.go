@@ -0,0 +1,323 @@
+// Copyright 2018 Andrew Werner, All Rights Reserved.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// decoder decodes entries from its input. It is implemented by EntryDecoder,
+// which splits the input at headers, and by LineDecoder.
+type decoder interface {
+	Decode(e *Entry) error
+	HoldPartial()
+	Held() []byte
+	Offset() int64
+}
+
+// LineDecoder decodes entries which are each a line of fields, such as a JSON
+// object or logfmt pairs. The header of an entry is the line and its message
+// is the newline which ends it, and its fields are available through
+// LogEntry.Field. Lines which cannot be parsed are returned as entries without
+// a header, as is unmatched text by an EntryDecoder which keeps it, and so are
+// lines longer than bufio.MaxScanTokenSize, which are truncated.
+type LineDecoder struct {
+	parse       func(line string) (map[string]interface{}, bool)
+	scanner     *bufio.Scanner
+	flatten     bool
+	transform   jqTransform
+	holdPartial bool
+	held        []byte
+	// truncated is set when a line too long to fit in the read buffer has
+	// been returned in part, and the rest of it is being skipped.
+	truncated bool
+
+	// offset is the input offset of the next byte to be split and
+	// tokenOffset is that of the most recently returned token.
+	offset, tokenOffset int64
+}
+
+// NewJSONDecoderSize returns a LineDecoder of JSON objects which reads from r
+// with an initial read buffer of the given size, which must be positive and no
+// larger than bufio.MaxScanTokenSize.
+func NewJSONDecoderSize(r io.Reader, size int) *LineDecoder {
+	return newLineDecoderSize(r, size, parseJSONLine)
+}
+
+// NewLogfmtDecoderSize is like NewJSONDecoderSize but decodes lines of logfmt
+// key=value pairs.
+func NewLogfmtDecoderSize(r io.Reader, size int) *LineDecoder {
+	return newLineDecoderSize(r, size, parseLogfmt)
+}
+
+func newLineDecoderSize(
+	r io.Reader, size int, parse func(string) (map[string]interface{}, bool),
+) *LineDecoder {
+	d := &LineDecoder{parse: parse, scanner: bufio.NewScanner(r)}
+	d.scanner.Buffer(make([]byte, size), bufio.MaxScanTokenSize)
+	d.scanner.Split(d.split)
+	return d
+}
+
+func parseJSONLine(line string) (map[string]interface{}, bool) {
+	var fields map[string]interface{}
+	if err := json.Unmarshal([]byte(line), &fields); err != nil || fields == nil {
+		return nil, false
+	}
+	return fields, true
+}
+
+// Flatten causes the nested objects and arrays of decoded fields to be
+// replaced by fields named by their dotted paths. See flattenFields.
+func (d *LineDecoder) Flatten() {
+	d.flatten = true
+}
+
+// flattenFields returns fields with each nested object and array replaced by
+// its elements, named by the path to them with the keys of objects and the
+// indexes of arrays separated by dots, as in request.id and tags.0. Empty
+// objects and arrays are kept as they are.
+func flattenFields(fields map[string]interface{}) map[string]interface{} {
+	flat := make(map[string]interface{}, len(fields))
+	var add func(prefix string, v interface{})
+	add = func(prefix string, v interface{}) {
+		switch v := v.(type) {
+		case map[string]interface{}:
+			if len(v) == 0 {
+				break
+			}
+			for k, v := range v {
+				add(prefix+"."+k, v)
+			}
+			return
+		case []interface{}:
+			if len(v) == 0 {
+				break
+			}
+			for i, v := range v {
+				add(prefix+"."+strconv.Itoa(i), v)
+			}
+			return
+		}
+		flat[prefix] = v
+	}
+	for k, v := range fields {
+		add(k, v)
+	}
+	return flat
+}
+
+// jqTransform applies a jq expression to the fields of an entry and returns
+// the first value it produces, or false if it produces none.
+type jqTransform func(fields map[string]interface{}) (v interface{}, ok bool, err error)
+
+// compileJQ compiles a jq expression. It is set by jq.go, which is only built
+// with the jq build tag so that the dependency on gojq is optional.
+var compileJQ func(expr string) (jqTransform, error)
+
+// Transform causes the fields of each entry to be replaced by the value
+// produced by t before they are flattened. If the value is an object its
+// fields become those of the entry, and other values become its msg field.
+// Entries for which t produces no value, null or false are skipped, as by jq's
+// select, and those for which it fails are left as they are.
+func (d *LineDecoder) Transform(t jqTransform) {
+	d.transform = t
+}
+
+// applyTransform returns the fields of an entry as transformed by t and whether
+// the entry is kept. See Transform.
+func applyTransform(t jqTransform, fields map[string]interface{}) (map[string]interface{}, bool) {
+	v, ok, err := t(fields)
+	if err != nil {
+		return fields, true
+	}
+	if !ok || v == nil || v == false {
+		return nil, false
+	}
+	if obj, isObj := v.(map[string]interface{}); isObj {
+		return obj, true
+	}
+	return map[string]interface{}{"msg": v}, true
+}
+
+// HoldPartial is like EntryDecoder.HoldPartial: a final line without a newline
+// is held back rather than decoded.
+func (d *LineDecoder) HoldPartial() {
+	d.holdPartial = true
+}
+
+// Held is like EntryDecoder.Held.
+func (d *LineDecoder) Held() []byte {
+	return d.held
+}
+
+// SetOffset is like EntryDecoder.SetOffset.
+func (d *LineDecoder) SetOffset(offset int64) {
+	d.offset = offset
+}
+
+// Offset returns the offset in the input of the next byte to be decoded.
+func (d *LineDecoder) Offset() int64 {
+	return d.offset
+}
+
+func (d *LineDecoder) split(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	if atEOF && len(data) == 0 {
+		return 0, nil, nil
+	}
+	if d.truncated {
+		// Skip the rest of a truncated line.
+		advance = len(data)
+		if i := bytes.IndexByte(data, '\n'); i >= 0 {
+			advance, d.truncated = i+1, false
+		}
+		d.offset += int64(advance)
+		return advance, nil, nil
+	}
+	if i := bytes.IndexByte(data, '\n'); i >= 0 {
+		advance, token = i+1, data[:i+1]
+	} else if !atEOF && len(data) >= bufio.MaxScanTokenSize {
+		// The line does not fit in the buffer, so return what has been read of
+		// it, as an EntryDecoder does with an entry which does not fit.
+		advance, token, d.truncated = len(data), data, true
+	} else if atEOF && len(data) > 0 && d.holdPartial {
+		d.held = append(d.held[:0], data...)
+		advance = len(data)
+	} else if atEOF {
+		advance, token = len(data), data
+	}
+	if token != nil {
+		d.tokenOffset = d.offset
+	}
+	d.offset += int64(advance)
+	return advance, token, nil
+}
+
+func (d *LineDecoder) Decode(e *Entry) error {
+	for {
+		if !d.scanner.Scan() {
+			if err := d.scanner.Err(); err != nil {
+				return err
+			}
+			return io.EOF
+		}
+		line := string(d.scanner.Bytes())
+		e.Offset = d.tokenOffset
+		e.matches = nil
+		if d.truncated {
+			// A truncated line is passed through as unmatched text, as what
+			// remains of it cannot be parsed.
+			e.Header, e.Message, e.fields = "", line+"\n", nil
+			return nil
+		}
+		trimmed := strings.TrimRight(line, "\r\n")
+		fields, ok := d.parse(trimmed)
+		if !ok {
+			e.Header, e.Message, e.fields = "", stripCR(line), nil
+			return nil
+		}
+		if d.transform != nil {
+			if fields, ok = applyTransform(d.transform, fields); !ok {
+				continue
+			}
+		}
+		if d.flatten {
+			fields = flattenFields(fields)
+		}
+		e.Header, e.Message, e.fields = trimmed, stripCR(line[len(trimmed):]), fields
+		return nil
+	}
+}
+
+// Field returns the value of the field with the given name of an entry decoded
+// by a LineDecoder, or the empty string if there is no such field. Fields of
+// nested objects are named by their path, as in request.id. Strings are
+// returned as they are and other values in their JSON encoding.
+func (le *LogEntry) Field(name string) string {
+	v, ok := lookupField(le.fields, name)
+	if !ok {
+		return ""
+	}
+	return fieldString(v)
+}
+
+// fieldString renders the value of a field as described by Field.
+func fieldString(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case nil:
+		return ""
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(b)
+}
+
+// FillTemplate returns the Serilog-style message template in the named field
+// of an entry decoded by a LineDecoder with each {Name} hole replaced by the
+// value of the property Name, which is found in the Properties field as
+// written by Serilog's JsonFormatter or among the fields as in its compact
+// format. The @ and $ operators and the format and alignment of a hole, as in
+// {@User} and {Elapsed:0.00}, are ignored, and holes for which there is no
+// property are left as they are. Braces are escaped by doubling them.
+func (le *LogEntry) FillTemplate(name string) string {
+	tmpl := le.Field(name)
+	var b strings.Builder
+	for i := 0; i < len(tmpl); i++ {
+		c := tmpl[i]
+		if (c == '{' || c == '}') && i+1 < len(tmpl) && tmpl[i+1] == c {
+			b.WriteByte(c)
+			i++
+			continue
+		}
+		end := strings.IndexByte(tmpl[i:], '}')
+		if c != '{' || end < 0 {
+			b.WriteByte(c)
+			continue
+		}
+		hole := tmpl[i+1 : i+end]
+		prop := strings.TrimLeft(hole, "@$")
+		if j := strings.IndexAny(prop, ",:"); j >= 0 {
+			prop = prop[:j]
+		}
+		v, ok := lookupField(le.fields, "Properties."+prop)
+		if !ok {
+			v, ok = lookupField(le.fields, prop)
+		}
+		if !ok || prop == "" {
+			b.WriteString(tmpl[i : i+end+1])
+		} else {
+			b.WriteString(fieldString(v))
+		}
+		i += end
+	}
+	return b.String()
+}
+
+// lookupField returns the value in fields at the dot-separated path name. A
+// field whose name contains dots is found before a nested one.
+func lookupField(fields map[string]interface{}, name string) (interface{}, bool) {
+	if v, ok := fields[name]; ok {
+		return v, true
+	}
+	for i := 0; i < len(name); i++ {
+		if name[i] != '.' {
+			continue
+		}
+		if nested, ok := fields[name[:i]].(map[string]interface{}); ok {
+			if v, ok := lookupField(nested, name[i+1:]); ok {
+				return v, true
+			}
+		}
+	}
+	return nil, false
+}
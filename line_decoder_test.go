@@ -0,0 +1,243 @@
+// Copyright 2018 Andrew Werner, All Rights Reserved.
+
+package main
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/wayneashleyberry/truecolor/pkg/color"
+)
+
+func TestFlattenFields(t *testing.T) {
+	for _, c := range []struct {
+		name string
+		in   map[string]interface{}
+		exp  map[string]interface{}
+	}{
+		{
+			name: "flat",
+			in:   map[string]interface{}{"msg": "hi", "n": 1.0},
+			exp:  map[string]interface{}{"msg": "hi", "n": 1.0},
+		},
+		{
+			name: "nested objects",
+			in: map[string]interface{}{
+				"req": map[string]interface{}{
+					"id":   7.0,
+					"user": map[string]interface{}{"name": "a"},
+				},
+			},
+			exp: map[string]interface{}{"req.id": 7.0, "req.user.name": "a"},
+		},
+		{
+			name: "arrays",
+			in: map[string]interface{}{
+				"tags": []interface{}{"x", "y"},
+				"spans": []interface{}{
+					map[string]interface{}{"id": "s1"},
+					[]interface{}{true},
+				},
+			},
+			exp: map[string]interface{}{
+				"tags.0":     "x",
+				"tags.1":     "y",
+				"spans.0.id": "s1",
+				"spans.1.0":  true,
+			},
+		},
+		{
+			name: "empty values are kept",
+			in: map[string]interface{}{
+				"obj":  map[string]interface{}{},
+				"arr":  []interface{}{},
+				"null": nil,
+			},
+			exp: map[string]interface{}{
+				"obj":  map[string]interface{}{},
+				"arr":  []interface{}{},
+				"null": nil,
+			},
+		},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			if got := flattenFields(c.in); !reflect.DeepEqual(got, c.exp) {
+				t.Fatalf("got %v, expected %v", got, c.exp)
+			}
+		})
+	}
+}
+
+func TestLineDecoderFlatten(t *testing.T) {
+	in := `{"msg":"hi","req":{"id":7,"user":{"name":"a b"}},"tags":["x","y"]}` + "\n"
+	d := NewJSONDecoderSize(strings.NewReader(in), 4096)
+	d.Flatten()
+	le := LogEntry{}
+	if err := d.Decode(&le.Entry); err != nil {
+		t.Fatal(err)
+	}
+	for name, exp := range map[string]string{
+		"msg":           "hi",
+		"req.id":        "7",
+		"req.user.name": "a b",
+		"tags.0":        "x",
+		"tags.1":        "y",
+		"req":           "",
+		"tags":          "",
+	} {
+		if got := le.Field(name); got != exp {
+			t.Errorf("Field(%q) = %q, expected %q", name, got, exp)
+		}
+	}
+	if err := d.Decode(&le.Entry); err != io.EOF {
+		t.Fatalf("expected EOF, got %v", err)
+	}
+}
+
+func TestLineDecoderCRLF(t *testing.T) {
+	in := "{\"msg\":\"hi\"}\r\nnot json\r\n{\"msg\":\"last\"}\r"
+	d := NewJSONDecoderSize(strings.NewReader(in), 4096)
+	var got [][2]string
+	for {
+		var e Entry
+		if err := d.Decode(&e); err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, [2]string{e.Header, e.Message})
+	}
+	exp := [][2]string{{`{"msg":"hi"}`, "\n"}, {"", "not json\n"}, {`{"msg":"last"}`, ""}}
+	if !reflect.DeepEqual(got, exp) {
+		t.Errorf("got %q, expected %q", got, exp)
+	}
+}
+
+// TestLineDecoderLongLine checks that a line too long for the read buffer is
+// passed through truncated rather than ending the input.
+func TestLineDecoderLongLine(t *testing.T) {
+	in := readFixture(t, "long-line.jsonl")
+	lines := strings.SplitAfter(in, "\n")
+	if len(lines[1]) <= bufio.MaxScanTokenSize {
+		t.Fatalf("the second line of the fixture is only %d bytes", len(lines[1]))
+	}
+	for _, size := range []int{4096, bufio.MaxScanTokenSize} {
+		d := NewJSONDecoderSize(strings.NewReader(in), size)
+		var got []Entry
+		for {
+			var e Entry
+			if err := d.Decode(&e); err == io.EOF {
+				break
+			} else if err != nil {
+				t.Fatalf("size %d: %v", size, err)
+			}
+			got = append(got, e)
+		}
+		if len(got) != 3 {
+			t.Fatalf("size %d: got %d entries, expected 3", size, len(got))
+		}
+		if got[0].Header != strings.TrimSuffix(lines[0], "\n") || got[2].Header != strings.TrimSuffix(lines[2], "\n") {
+			t.Errorf("size %d: the lines around the long line were not decoded: %q, %q", size, got[0].Header, got[2].Header)
+		}
+		if exp := lines[1][:bufio.MaxScanTokenSize] + "\n"; got[1].Header != "" || got[1].Message != exp {
+			t.Errorf("size %d: the long line was not truncated to %d bytes", size, bufio.MaxScanTokenSize)
+		}
+		if got[2].Offset != int64(len(lines[0])+len(lines[1])) {
+			t.Errorf("size %d: the entry after the long line has offset %d, expected %d", size, got[2].Offset, len(lines[0])+len(lines[1]))
+		}
+	}
+}
+
+func TestExpandJSONFlatten(t *testing.T) {
+	noColor := func(string) *color.Message { return color.Color(0, 0, 0) }
+	msg := `request {"b":{"c":1,"d":[true,"x y"]},"a":"z"} done`
+	for _, c := range []struct {
+		flatten bool
+		exp     string
+	}{
+		{false, `request a=z b={"c":1,"d":[true,"x y"]} done`},
+		{true, `request a=z b.c=1 b.d.0=true b.d.1="x y" done`},
+	} {
+		got := stripEscapes(expandJSON(noColor, c.flatten)(msg))
+		if got != c.exp {
+			t.Errorf("flatten=%v: got %q, expected %q", c.flatten, got, c.exp)
+		}
+	}
+}
+
+func TestApplyTransform(t *testing.T) {
+	fields := map[string]interface{}{"msg": "hi"}
+	fail := errors.New("failed")
+	for _, c := range []struct {
+		name string
+		v    interface{}
+		ok   bool
+		err  error
+		exp  map[string]interface{}
+		keep bool
+	}{
+		{"object", map[string]interface{}{"a": 1.0}, true, nil, map[string]interface{}{"a": 1.0}, true},
+		{"string", "x", true, nil, map[string]interface{}{"msg": "x"}, true},
+		{"true", true, true, nil, map[string]interface{}{"msg": true}, true},
+		{"no value", nil, false, nil, nil, false},
+		{"null", nil, true, nil, nil, false},
+		{"false", false, true, nil, nil, false},
+		{"error", nil, false, fail, fields, true},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			tr := func(map[string]interface{}) (interface{}, bool, error) { return c.v, c.ok, c.err }
+			got, keep := applyTransform(tr, fields)
+			if keep != c.keep || !reflect.DeepEqual(got, c.exp) {
+				t.Fatalf("got %v, %v, expected %v, %v", got, keep, c.exp, c.keep)
+			}
+		})
+	}
+}
+
+func TestFillTemplate(t *testing.T) {
+	for _, c := range []struct {
+		name string
+		line string
+		exp  string
+	}{
+		{
+			name: "properties",
+			line: `{"MessageTemplate":"User {UserId} from {@Client}","Properties":{"UserId":42,"Client":{"Ip":"10.0.0.7"}}}`,
+			exp:  `User 42 from {"Ip":"10.0.0.7"}`,
+		},
+		{
+			name: "compact",
+			line: `{"@mt":"Took {Elapsed:0.00} ms for {$Name,-10}","Elapsed":3.5,"Name":"q"}`,
+			exp:  `Took 3.5 ms for q`,
+		},
+		{
+			name: "escaped braces and missing properties",
+			line: `{"@mt":"{{literal}} {Missing} {} }}","Properties":{}}`,
+			exp:  `{literal} {Missing} {} }`,
+		},
+		{
+			name: "unterminated hole",
+			line: `{"@mt":"oops {Name","Name":"x"}`,
+			exp:  `oops {Name`,
+		},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			d := NewJSONDecoderSize(strings.NewReader(c.line+"\n"), 4096)
+			le := LogEntry{}
+			if err := d.Decode(&le.Entry); err != nil {
+				t.Fatal(err)
+			}
+			field := "MessageTemplate"
+			if le.Field(field) == "" {
+				field = "@mt"
+			}
+			if got := le.FillTemplate(field); got != c.exp {
+				t.Fatalf("got %q, expected %q", got, c.exp)
+			}
+		})
+	}
+}
@@ -0,0 +1,139 @@
+// Copyright 2018 Andrew Werner, All Rights Reserved.
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/lucasb-eyer/go-colorful"
+)
+
+// streamColorizer colorizes whole streams with the header pattern and output
+// template, giving each stream a color map of its own. It supports only the
+// options which configure the pattern, template and color map, and not those
+// which filter or transform entries.
+type streamColorizer struct {
+	// entry is copied to decode the entries of each stream.
+	entry         LogEntry
+	colors        *colorMap
+	template      string
+	chipColors    map[level]colorful.Color
+	bufferSize    int
+	keepUnmatched bool
+	strict        bool
+	indentBlocks  bool
+	continuation  *regexp.Regexp
+	// newLineDecoder, if set, decodes entries in place of the header pattern.
+	newLineDecoder func(io.Reader, int) *LineDecoder
+	flattenJSON    bool
+	transform      jqTransform
+}
+
+// colorize decodes the entries read from r and writes them colorized to w
+// until r is exhausted.
+func (c *streamColorizer) colorize(r io.Reader, w io.Writer) error {
+	cm := c.colors.withSettings()
+	tmpl, err := newTemplate(c.template, cm, cm.getColor, c.chipColors, c.entry.gradient, c.flattenJSON)
+	if err != nil {
+		return err
+	}
+	le := c.entry
+	le.colors = cm
+	le.subexpNames = map[string][]int{}
+	// Context keys, expression colors and timings hold state which is not
+	// safe to share between streams.
+	le.contexts, le.expr, le.sessionColor, le.timings = nil, nil, nil, nil
+	bw := bufio.NewWriter(w)
+	br := NewBufferedReader(r, 10*time.Millisecond)
+	newDecoder := func() decoder {
+		if c.newLineDecoder != nil {
+			d := c.newLineDecoder(br, c.bufferSize)
+			if c.transform != nil {
+				d.Transform(c.transform)
+			}
+			if c.flattenJSON {
+				d.Flatten()
+			}
+			return d
+		}
+		d := NewEntryDecoderSize(le.Pattern, br, c.bufferSize)
+		if c.keepUnmatched {
+			d.KeepUnmatched()
+		}
+		if c.strict {
+			d.Strict()
+		}
+		if c.indentBlocks {
+			d.IndentBlocks()
+		}
+		if c.continuation != nil {
+			d.Continuation(c.continuation)
+		}
+		return d
+	}
+	d := newDecoder()
+	for {
+		switch err := d.Decode(&le.Entry); err {
+		case nil:
+			if le.Header == "" {
+				err = printUnmatched(bw, le.Message, cm.getColor)
+			} else {
+				cm.count(le.colorMapKey())
+				err = tmpl.Execute(bw, &le)
+			}
+			if err != nil {
+				return err
+			}
+		case io.EOF:
+			if err := bw.Flush(); err != nil {
+				return err
+			}
+			d = newDecoder()
+		case io.ErrUnexpectedEOF:
+			return bw.Flush()
+		default:
+			return err
+		}
+	}
+}
+
+// serve listens on addr, which is either host:port for TCP or unix:PATH for a
+// Unix socket, and colorizes the stream read from each connection back to it.
+// Each connection is served by its own goroutine. It returns when stop is
+// closed or if accepting a connection fails.
+func serve(addr string, c *streamColorizer, stop <-chan struct{}) error {
+	network := "tcp"
+	if strings.HasPrefix(addr, "unix:") {
+		network, addr = "unix", strings.TrimPrefix(addr, "unix:")
+	}
+	l, err := net.Listen(network, addr)
+	if err != nil {
+		return err
+	}
+	go func() {
+		<-stop
+		l.Close()
+	}()
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if stopped(stop) {
+				return nil
+			}
+			return err
+		}
+		go func() {
+			defer conn.Close()
+			if err := c.colorize(conn, conn); err != nil {
+				fmt.Fprintf(os.Stderr, "logcolor: %v: %v\n", conn.RemoteAddr(), err)
+			}
+		}()
+	}
+}
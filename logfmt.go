@@ -0,0 +1,65 @@
+// Copyright 2018 Andrew Werner, All Rights Reserved.
+
+package main
+
+import "strconv"
+
+// parseLogfmt parses a line of logfmt pairs such as
+//
+//	ts=2018-10-15T10:00:00Z level=info msg="listening on :8080" tls
+//
+// Values may be quoted to hold spaces, with escapes as in Go strings, and a
+// key without a value is given the value true. A line is only taken to be
+// logfmt if it has at least one key=value pair.
+func parseLogfmt(line string) (map[string]interface{}, bool) {
+	fields := map[string]interface{}{}
+	pairs := 0
+	for i := 0; i < len(line); {
+		if line[i] == ' ' || line[i] == '\t' {
+			i++
+			continue
+		}
+		start := i
+		for i < len(line) && line[i] != '=' && line[i] != ' ' && line[i] != '\t' {
+			if line[i] == '"' {
+				return nil, false
+			}
+			i++
+		}
+		key := line[start:i]
+		if i == len(line) || line[i] != '=' {
+			fields[key] = true
+			continue
+		}
+		i++
+		if i < len(line) && line[i] == '"' {
+			end := i + 1
+			for end < len(line) && line[end] != '"' {
+				if line[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(line) {
+				return nil, false
+			}
+			v, err := strconv.Unquote(line[i : end+1])
+			if err != nil {
+				return nil, false
+			}
+			fields[key] = v
+			i = end + 1
+		} else {
+			start = i
+			for i < len(line) && line[i] != ' ' && line[i] != '\t' {
+				i++
+			}
+			fields[key] = line[start:i]
+		}
+		if key == "" {
+			return nil, false
+		}
+		pairs++
+	}
+	return fields, pairs > 0
+}
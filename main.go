@@ -6,16 +6,18 @@ package main
 
 import (
 	"bufio"
-	"crypto/md5"
-	"encoding/binary"
+	"bytes"
 	"flag"
 	"fmt"
 	"io"
-	"math"
 	"os"
 	"regexp"
+	"runtime/pprof"
+	"strconv"
+	"strings"
 	"text/template"
 	"time"
+	"unicode"
 
 	"github.com/lucasb-eyer/go-colorful"
 	"github.com/wayneashleyberry/truecolor/pkg/color"
@@ -24,102 +26,1304 @@ import (
 //go:generate go doc '"github.com/ajwerner/logcolor".LogEntry
 
 func main() {
-	headerPattern := flag.String("log-header-pattern", `(?m)^(?P<prefix>^[\w_\-.]+> )(?P<header>([IWEF])(\d{6} \d{2}:\d{2}:\d{2}.\d{6}) (?:(\d+) )?([^:]+):(\d+))`, "Capture group for log header")
-	outTemplate := flag.String("output-template", `
-{{- with $p := .Match "prefix" -}}
-{{- with $c := color $p -}}
-{{ $.Match "header" | printf "%s%s" $p | $c.Sprint  }}
-{{- end -}}
-{{- end -}}
-{{- .Message -}}`,
-		"Golang text template for outputting the body.")
+	headerPattern := flag.String("log-header-pattern", presets["glog"].pattern, "Capture group for log header")
+	outTemplate := flag.String("output-template", presets["glog"].template,
+		"Golang text template for outputting the body. Besides color, the functions bg, statuscolor, severityColor (or severitycolor), severitygradient, levelchip, expandjson, shortid, bold, dim, underline, humanbytes, humanduration, visiblelen, parseTime and timefmt are available. parseTime LAYOUT TEXT returns a time which timefmt LAYOUT formats, where the layout relative gives times such as 5s ago.")
+	inputFormat := flag.String("input-format", "regexp", "Format of the input, either regexp, entries which begin with a match of the header pattern, json, a JSON object on each line, or logfmt, key=value pairs on each line. The fields of json and logfmt entries are available to templates through .Field, such as {{ .Field \"level\" }}, and in place of capture groups. .FillTemplate fills the Serilog message template in a field with the properties of the entry.")
+	outputFormat := flag.String("output-format", "text", "Format of the output, either text, rendered with the output template, csv, with a column for each named capture group and the message, trace-event, Chrome trace events on a track for each color key, html, the text output as a standalone HTML document with colors given by CSS, or svg, the text output as an SVG image. The image assumes a 14px monospace font whose characters are 0.6em wide and holds at most 2000 lines of 240 columns.")
+	background := flag.String("background", "dark", "Background of html and svg output, either dark or light.")
+	durationGroup := flag.String("duration-group", "duration", "Capture group which holds the duration of an entry for trace-event output, either with a unit, such as 3.4ms, or as a number of milliseconds.")
+	phaseGroup := flag.String("phase-group", "phase", "Capture group which marks an entry for trace-event output as the beginning of a span, with begin, start or B, or its end, with end, stop or E. A span lasts from its beginning to the next end on the same track.")
+	seekToPattern := flag.String("seek-to", "", "Skip entries until one whose header or message matches this regexp, such as a deployment marker, and process the input from there.")
+	untilPattern := flag.String("until-pattern", "", "Stop after the first entry whose header or message matches this regexp. With -seek-to, only an entry after the one sought can match.")
+	since := flag.String("since", "", "Skip entries whose timestamp is before this time, such as 15:04:05, which matches that time of day on any date, or 2006-01-02T15:04:05Z.")
+	until := flag.String("until", "", "Skip entries whose timestamp is after this time, given like -since. To stop at an entry matching a regexp instead, use -until-pattern.")
+	timeLayout := flag.String("time-layout", "", "Go layout of the timestamps of entries, such as 060102 15:04:05.000000, used by -since and -until. By default the layouts of common log formats are tried.")
+	strictTime := flag.Bool("strict-time", false, "Skip entries whose timestamp is missing or cannot be parsed when -since or -until is set, rather than keeping them.")
+	byteStart := flag.Int64("byte-start", 0, "Offset in bytes at which to start reading the input, which must be seekable. Entries begin at the first header after the offset.")
+	byteEnd := flag.Int64("byte-end", 0, "If positive, stop at the first entry which starts at or after this offset in bytes. The entry which spans the offset is output in full.")
+	presetName := flag.String("preset", "", "Use the header pattern and output template of a known log format unless they are set explicitly. One of "+presetNames()+".")
+	minLevel := flag.String("min-level", "", "Skip entries whose severity is below this level. Entries of an unknown level are kept.")
+	minStatus := flag.Int("min-status", 0, "Skip entries whose status capture is an HTTP status code less than this.")
+	colorByExpr := flag.String("color-by-expr", "", "Color entries by the value of an arithmetic expression over capture groups, such as latency/upstream_latency, on a gradient from green to red. Entries for which it has no value are colored by their key.")
+	severityGradientSpec := flag.String("severity-gradient", "", "Color entries by a numeric severity on a discrete scale, given as GROUP:THRESHOLDS:COLORS, such as score:3,5:#4caf50,#ffca28,#ef5350, with one more color than thresholds. A value at a threshold takes the color above it. The scale is also available to templates as severitygradient.")
+	exprRange := flag.String("expr-range", "0:1", "The values of -color-by-expr, given as LOW:HIGH, which map to the ends of its gradient.")
+	sessionStart := flag.String("session-start", "", "Color each run of entries from one matching this regexp to one matching -session-end alike, cycling through colors so that adjacent sessions differ. A start within a session begins a new one.")
+	sessionEnd := flag.String("session-end", "", "Regexp matching the last entry of a session begun by -session-start. If unset, sessions last until the next start.")
+	contextRegex := flag.String("context-regex", "", "If set, the first submatch (or the whole match) of this regexp against an entry is a context id, such as a request id, and entries which mention an id are given the color key of the first entry which mentioned it.")
+	hueFrom := flag.String("hue-from", "", "Capture group, such as a tenant or cluster id, which chooses the region of the hue wheel from which the colors of the keys of its entries are drawn, so that the entries of different tenants are told apart even where their keys collide. The wheel is divided into 8 sectors and each tenant is given one by its hash.")
+	colorByRegex := flag.String("color-by-regex", "", "If set, the first submatch (or the whole match) of this regexp against the entry is used as its color key rather than the prefix.")
+	colorByField := flag.String("color-by-field", "prefix", "Capture group, or field of json and logfmt entries such as Attributes.service.name, whose value is the color key of an entry unless -color-by-regex is set.")
+	alignNumeric := flag.String("align-numeric", "", "Capture group holding a number which is padded to line up with the numbers of recent entries at its decimal point.")
+	highlightChanges := flag.String("highlight-changes", "", "Comma-separated capture groups whose values are highlighted when they differ from those of the previous entry.")
+	maskTimestamps := flag.Bool("mask-timestamps", false, "Replace the timestamp in the output with a fixed placeholder so that the output of separate runs can be diffed.")
+	relativeTimes := flag.Bool("relative-time", false, "Replace the timestamp in the output with the time since that of the first entry, such as +0.512s. Timestamps which cannot be parsed are left unchanged.")
+	timestampGroup := flag.String("timestamp-group", "time", "Capture group which holds the timestamp of an entry.")
+	pinTop := flag.Int("pin-top", 0, "If positive, only the N most frequently seen color keys get vivid colors; the rest get muted colors.")
+	inputBufferSize := flag.Int("input-buffer-size", 4096, "Initial size in bytes of the buffer into which input is read.")
+	fallbackColorPrefix := flag.Bool("fallback-color-prefix", false, "Pass through text which does not match the header pattern, coloring it by its first whitespace-delimited field.")
+	intensityByLevel := flag.Bool("intensity-by-level", false, "Make the color of more severe entries more vivid and that of less severe entries more muted while keeping the hue of their color key.")
+	nameKeys := flag.Bool("name-keys", false, "Give each color key a memorable name derived from its hash, available to templates as .ColorName and printed by the default templates.")
+	levelColors := flag.String("level-colors", defaultLevelColors, "Comma-separated level=#rrggbb background colors used by the levelchip template function.")
+	patternStatsFormat := flag.String("pattern-stats", "", "At the end of the input, report to stderr how many entries the header pattern matched and how many lines matched no pattern, as a table or json.")
+	colorMode := flag.String("color", "auto", "When to color output: always, never, or auto to color only when stdout is a terminal and NO_COLOR is empty or unset.")
+	dumpColorMap := flag.String("dump-color-map", "", "Write the color given to each key, along with the settings which chose them, to this file as JSON when input ends.")
+	loadColorMap := flag.String("load-color-map", "", "Give keys the colors recorded in this file by -dump-color-map in place of the ones they would otherwise be given.")
+	sparkline := flag.Bool("sparkline", false, "At EOF, print a sparkline of the number of entries of each color key over the run to stderr, by their timestamps if every entry has one or otherwise by their order.")
+	pauseKey := flag.Bool("pause-key", false, "When writing to a terminal, pause the output when space is pressed and resume it on the next key, holding the output in between.")
+	pauseBuffer := flag.Int("pause-buffer", 1<<20, "Bytes of output held while paused by -pause-key, beyond which the oldest lines are dropped.")
+	chromaMin := flag.Float64("chroma-min", defaultChroma.min, "Least chroma, from 0 to 1, of the colors of keys. Raise it for more vivid colors.")
+	chromaMax := flag.Float64("chroma-max", defaultChroma.max, "Greatest chroma, from 0 to 1, of the colors of keys.")
+	lightnessMin := flag.Float64("lightness-min", defaultLightness.min, "Least lightness, from 0 to 1, of the colors of keys. Lower it for light backgrounds.")
+	lightnessMax := flag.Float64("lightness-max", defaultLightness.max, "Greatest lightness, from 0 to 1, of the colors of keys.")
+	explain := flag.Bool("explain", false, "Write to stderr, for each entry, how its color was chosen: its color key, how the key was hashed, and the resulting color.")
+	hueDrift := flag.Duration("hue-drift", 0, "Experimental. If positive, rotate the hues of all keys once around the wheel over this period, such as 24h, so that older entries still on screen are subtly distinguishable from newer ones. As the rotation follows the clock, the same input is not colored the same way twice.")
+	colorSeed := flag.String("color-seed", "", "Prepend this to each color key before it is hashed. The same seed always gives the same colors, and changing it reshuffles the colors of all keys, as to separate two keys whose colors are too alike.")
+	maxRate := flag.Int("max-rate", 0, "If positive, write at most this many lines of output per second so that a fast stream can be read, queueing the rest.")
+	maxRateBuffer := flag.Int("max-rate-buffer", 1000, "Lines queued by -max-rate, beyond which the oldest are dropped and a line noting how many were dropped is written in their place.")
+	colorCache := flag.String("color-cache", "", "Give keys the colors recorded in this file, in the format of -dump-color-map, and add the colors of newly seen keys to it at exit, so that keys keep their colors across runs with different settings.")
+	legend := flag.Bool("legend", false, "At EOF, print each color key beside a swatch of its color to stderr.")
+	colorDepth := flag.String("color-depth", "truecolor", "Colors available to the output: truecolor, 256, or 16. With 256 or 16, colors are replaced by the nearest of the 256 color palette or of the 16 basic ANSI colors.")
+	stableIndex := flag.Bool("stable-index", false, "With -color-depth 256, choose the palette index of each key directly from its hash so that the escapes are compact and stable, as for snapshot tests.")
+	colorRing := flag.Int("color-ring", 0, "Choose colors from a fixed ring of this many colors, with hues spread around the color wheel by the golden angle, by consistent hashing, so that keys keep their colors as the set of keys changes and most keep them when the number of colors changes.")
+	colorKeyLength := flag.Int("color-key-length", 0, "Color by only the first N runes of each color key, or the last -N if negative, so that keys which share a prefix or suffix share a color.")
+	expandTabWidth := flag.Int("expand-tabs", 0, "Replace tabs in messages with spaces up to the next multiple of this many columns. Tabs are preserved if 0.")
+	preserveTabs := flag.Bool("preserve-tabs", false, "Keep tabs in messages. Cannot be combined with -expand-tabs.")
+	highlightStacksFlag := flag.Bool("highlight-stacks", false, "Color the function names, file paths and line numbers of Go stack traces in messages.")
+	expandJSONMessage := flag.Bool("expand-json-message", false, "Render a JSON object in the message of an entry as colored key=value pairs. The same transformation is available to templates as expandjson.")
+	jqExpr := flag.String("jq", "", "Transform the fields of json and logfmt entries with this jq expression, such as {msg, key: .request.user}. An object it produces replaces the fields and another value becomes the msg field. Entries for which it produces nothing, null or false are skipped. Requires building with -tags jq.")
+	flattenJSON := flag.Bool("flatten-json", false, "Flatten the nested objects and arrays of json entries, and of the JSON objects rendered by -expand-json-message and expandjson, into fields named by their dotted paths, such as request.id and tags.0, which can be selected by .Field and -color-by-field.")
+	colorKV := flag.Bool("colorize-kv", false, "Color the key of each key=value pair in the message of an entry by its name, so that a field has the same color in every entry. Values may be quoted to hold spaces.")
+	kvValueTypes := flag.Bool("kv-value-types", false, "With -colorize-kv, also color values as numbers, booleans or null, or quoted strings.")
+	dimBelow := flag.String("dim-below", "", "Darken the color and dim the message of entries less severe than this level, e.g. I or INFO.")
+	severityGroup := flag.String("severity-group", "severity", "Capture group which holds the severity of an entry.")
+	summarize := flag.Bool("summary", false, "At EOF, print each distinct error or fatal message with its count and the timestamps of its first and last occurrence.")
+	summaryOutput := flag.String("summary-output", "", "File to which to write the -summary rather than stderr.")
+	selfTiming := flag.Bool("self-timing", false, "At EOF, print the time spent decoding, looking up colors, and templating to stderr.")
+	watch := flag.String("watch", "", "Watch the named file, clearing the screen and outputting it again from the top whenever it changes.")
+	indentBlocks := flag.Bool("indent-blocks", false, "Keep lines indented further than the line on which an entry begins in the entry even if they contain a header, as for embedded YAML or Python tracebacks.")
+	continuationPattern := flag.String("continuation-pattern", "", "If set, only lines matching this regexp, such as ^\\s or ^\\|, continue the entry before them. Other lines which do not begin an entry are unmatched text, which is dropped unless -fallback-color-prefix is set.")
+	boundary := flag.String("boundary", "lazy", "Where headers begin entries, either lazy, anywhere in the text, or strict, only at the start of a line.")
+	inputEncoding := flag.String("input-encoding", "utf-8", "Encoding of the input, which is transcoded to UTF-8. One of utf-8, latin1, utf-16, utf-16le or utf-16be.")
+	debugMatchFlag := flag.Bool("debug-match", false, "Rather than formatting entries, print each line of the input marked with whether the header pattern matches it along with the text captured by each group.")
+	fullRowBy := flag.String("full-row", "", "Set the background of each whole line, padded to the width of the terminal given by COLUMNS, by its severity or color key. One of severity or key.")
+	dedupWindowSize := flag.Int("dedup-window", 0, "Suppress entries whose color key and message repeat one of the last N distinct entries, where messages differing only in their numbers are repeats, reporting the number of repeats when the message leaves the window or at the end of the input.")
+	diffAgainst := flag.String("diff-against", "", "Compare entries with those of this reference log, marking entries whose message signature does not appear in it with a green + and coloring their messages green.")
+	groupByKey := flag.Bool("group-by-key", false, "Buffer the whole input and at its end write the entries grouped by color key. All entries are held in memory, so this is only suitable for bounded input.")
+	collapseHeaders := flag.Bool("collapse-identical-headers", false, "Write the header of a run of consecutive entries with identical headers once, followed by the message of each entry of the run indented beneath it.")
+	compactRepeats := flag.Bool("compact-repeats", false, "When writing to a terminal, collapse runs of a repeated line into the line and a count which is updated in place.")
+	dockerFraming := flag.Bool("docker-framing", false, "Demultiplex the input as a raw Docker attach or logs stream, prefixing each line with the name of its stream.")
+	filesFrom := flag.String("files-from", "", "Read the paths of files to process, one per line, from this file, or from stdin if -. They are read after any given as arguments.")
+	teardownTimeout := flag.Duration("teardown-timeout", 5*time.Second, "On interrupt or termination, how long to wait for the output to be flushed before exiting regardless.")
+	listen := flag.String("listen", "", "Listen on host:port, or unix:PATH, and write the stream read from each connection back to it colorized. Each connection has its own colors, and options which filter or transform entries do not apply.")
+	maxRuntime := flag.Duration("max-runtime", 0, "If positive, stop and flush the output after this long even if the input has not ended.")
+	tail := flag.Bool("f", false, "Follow the last file given like tail -f, reading data as it is appended to it.")
+	syslogUDP := flag.String("syslog-udp", "", "Receive syslog messages sent to this UDP host:port, reassembling messages split across datagrams. Implies -preset syslog unless another preset is given.")
+	followName := flag.String("F", "", "Follow the named file like tail -F, reopening it if it is rotated or truncated.")
+	cpuProfile := flag.String("cpuprofile", "", "Write a CPU profile to this file.")
+	var categories categoryFlag
+	flag.Var(&categories, "category", "Give entries matching a regexp a fixed color, given as REGEXP=#rrggbb. May be repeated, in which case the first matching category applies. Entries matching no category are colored by their key.")
+	var pads padFlag
+	flag.Var(&pads, "pad-group", "Pad the value of a capture group with spaces to a number of columns, given as group=N, and truncate longer values if given as group=N,truncate. May be repeated.")
+	var sinks sinkFlag
+	flag.Var(&sinks, "sink", "Also write entries which pass a filter to a file, given as file=PATH[,level=LEVEL][,grep=REGEXP]. May be repeated.")
+	var grep, grepInvert regexpFlag
+	flag.Var(&grep, "grep", "Skip entries whose message does not match this regexp. May be repeated, in which case entries must match them all.")
+	flag.Var(&grepInvert, "grep-invert", "Skip entries whose message matches this regexp. May be repeated.")
+	var highlights regexpFlag
+	flag.Var(&highlights, "highlight", "Highlight the text of messages matching this regexp in bold reverse video. May be repeated.")
+	grepWhole := flag.Bool("grep-whole-entry", false, "Match -grep and -grep-invert against the header of each entry as well as its message.")
+	var testEntries testEntryFlag
+	flag.Var(&testEntries, "test-entry", "Rather than reading the input, decode this text as a log line, print it rendered by the output template, and exit. May be repeated to render several lines. Lines which do not match the header pattern are reported to stderr.")
 	flag.Parse()
+	if *cpuProfile != "" {
+		f, err := os.Create(*cpuProfile)
+		dieIf(err)
+		defer f.Close()
+		dieIf(pprof.StartCPUProfile(f))
+		defer pprof.StopCPUProfile()
+	}
+	if *syslogUDP != "" && *presetName == "" {
+		*presetName = "syslog"
+	}
+	set := map[string]bool{}
+	flag.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	var p preset
+	if *presetName != "" {
+		var ok bool
+		if p, ok = presets[*presetName]; !ok {
+			dieIf(fmt.Errorf("unknown preset %v, expected one of %v", *presetName, presetNames()))
+		}
+		if p.inputFormat != "" && !set["input-format"] {
+			*inputFormat = p.inputFormat
+		}
+	}
+	// newLineDecoder, if set, decodes entries of fields in place of the header
+	// pattern.
+	var newLineDecoder func(io.Reader, int) *LineDecoder
+	switch *inputFormat {
+	case "regexp":
+	case "json":
+		newLineDecoder = NewJSONDecoderSize
+	case "logfmt":
+		newLineDecoder = NewLogfmtDecoderSize
+	default:
+		dieIf(fmt.Errorf("unknown -input-format %q, expected regexp, json or logfmt", *inputFormat))
+	}
+	if *presetName != "" && p.inputFormat != *inputFormat && (p.inputFormat != "" || newLineDecoder != nil) {
+		dieIf(fmt.Errorf("-preset %v cannot be used with -input-format %v", *presetName, *inputFormat))
+	}
+	if newLineDecoder != nil {
+		if *debugMatchFlag || *patternStatsFormat != "" || *outputFormat == "csv" {
+			dieIf(fmt.Errorf("-input-format %v cannot be used with -debug-match, -pattern-stats or -output-format csv", *inputFormat))
+		}
+		if !set["output-template"] {
+			*outTemplate = fieldsTemplate
+		}
+		if !set["severity-group"] {
+			*severityGroup = "level"
+		}
+	}
+	var transform jqTransform
+	if *jqExpr != "" {
+		if newLineDecoder == nil {
+			dieIf(fmt.Errorf("-jq requires -input-format json or logfmt"))
+		}
+		if compileJQ == nil {
+			dieIf(fmt.Errorf("-jq requires building with -tags jq"))
+		}
+		t, err := compileJQ(*jqExpr)
+		if err != nil {
+			dieIf(fmt.Errorf("invalid -jq expression %q: %v", *jqExpr, err))
+		}
+		transform = t
+	}
+	if *presetName != "" {
+		if !set["log-header-pattern"] && p.pattern != "" {
+			*headerPattern = p.pattern
+		}
+		if !set["output-template"] {
+			*outTemplate = p.template
+		}
+		if !set["severity-group"] && p.severityGroup != "" {
+			*severityGroup = p.severityGroup
+		}
+		if !set["color-by-field"] && p.colorField != "" {
+			*colorByField = p.colorField
+		}
+	}
 	pattern, err := regexp.Compile(*headerPattern)
 	dieIf(err)
+	var continuation *regexp.Regexp
+	if *continuationPattern != "" {
+		continuation, err = regexp.Compile(*continuationPattern)
+		dieIf(err)
+	}
+	if *inputBufferSize <= 0 || *inputBufferSize > bufio.MaxScanTokenSize {
+		dieIf(fmt.Errorf("input-buffer-size must be in (0, %d]", bufio.MaxScanTokenSize))
+	}
+	var seekTo, untilRE *regexp.Regexp
+	if *seekToPattern != "" {
+		seekTo, err = regexp.Compile(*seekToPattern)
+		dieIf(err)
+	}
+	if *untilPattern != "" {
+		untilRE, err = regexp.Compile(*untilPattern)
+		dieIf(err)
+	}
+	var window *timeWindow
+	if *since != "" || *until != "" {
+		window = &timeWindow{layout: *timeLayout, strict: *strictTime}
+		if *since != "" {
+			window.since, err = parseTimeBound(*since, *timeLayout)
+			dieIf(err)
+		}
+		if *until != "" {
+			window.until, err = parseTimeBound(*until, *timeLayout)
+			dieIf(err)
+		}
+	}
+	var colorBy *regexp.Regexp
+	if *colorByRegex != "" {
+		colorBy, err = regexp.Compile(*colorByRegex)
+		dieIf(err)
+	}
+	var sess *sessions
+	if *sessionStart != "" {
+		start, err := regexp.Compile(*sessionStart)
+		dieIf(err)
+		var end *regexp.Regexp
+		if *sessionEnd != "" {
+			end, err = regexp.Compile(*sessionEnd)
+			dieIf(err)
+		}
+		sess = newSessions(start, end)
+	} else if *sessionEnd != "" {
+		dieIf(fmt.Errorf("-session-end requires -session-start"))
+	}
+	var contexts *contextKeys
+	if *contextRegex != "" {
+		re, err := regexp.Compile(*contextRegex)
+		dieIf(err)
+		contexts = newContextKeys(re)
+	}
+	var st *timings
+	if *selfTiming {
+		st = newTimings()
+	}
 	// so we want to parse the template
-	cm := colorMap{}
-	tmpl, err := template.New("logs").Funcs(template.FuncMap{
-		"color": cm.getColor,
-	}).Parse(*outTemplate)
-
+	if *expandTabWidth < 0 || (*preserveTabs && *expandTabWidth > 0) {
+		dieIf(fmt.Errorf("-expand-tabs must be positive and cannot be combined with -preserve-tabs"))
+	}
+	var strictBoundary bool
+	switch *boundary {
+	case "lazy":
+	case "strict":
+		strictBoundary = true
+	default:
+		dieIf(fmt.Errorf("unknown -boundary %q, expected strict or lazy", *boundary))
+	}
+	var minLevelValue level
+	if *minLevel != "" {
+		if minLevelValue = parseLevel(*minLevel); minLevelValue == unknownLevel {
+			dieIf(fmt.Errorf("unknown -min-level %q", *minLevel))
+		}
+	}
+	cm := newColorMap()
+	cm.keyLength = *colorKeyLength
+	if *colorRing < 0 {
+		dieIf(fmt.Errorf("-color-ring must not be negative"))
+	}
+	if *colorRing > 0 {
+		cm.ring = newColorRing(*colorRing)
+	}
+	var depth int
+	switch *colorDepth {
+	case "truecolor":
+	case "256":
+		depth = 256
+	case "16":
+		depth = 16
+	default:
+		dieIf(fmt.Errorf("unknown -color-depth %q, expected truecolor, 256 or 16", *colorDepth))
+	}
+	if *stableIndex && depth != 256 {
+		dieIf(fmt.Errorf("-stable-index requires -color-depth 256"))
+	}
+	cm.stableIndex = *stableIndex
+	if *hueDrift < 0 || (*hueDrift > 0 && (*stableIndex || *colorRing > 0)) {
+		dieIf(fmt.Errorf("-hue-drift must not be negative and cannot be combined with -stable-index or -color-ring"))
+	}
+	cm.hueDrift, cm.start = *hueDrift, time.Now()
+	cm.seed = *colorSeed
+	cm.chroma = hclRange{*chromaMin, *chromaMax}
+	dieIf(cm.chroma.validate("chroma"))
+	cm.lightness = hclRange{*lightnessMin, *lightnessMax}
+	dieIf(cm.lightness.validate("lightness"))
+	if *loadColorMap != "" {
+		dieIf(cm.load(*loadColorMap))
+	}
+	if *colorCache != "" {
+		if err := cm.load(*colorCache); !os.IsNotExist(err) {
+			dieIf(err)
+		}
+	}
+	switch *colorMode {
+	case "auto":
+		// NO_COLOR disables color if it is set to anything but the empty string.
+		noColor = os.Getenv("NO_COLOR") != "" || (!isTerminal(os.Stdout) && *outputFormat != "html" && *outputFormat != "svg")
+	case "always":
+	case "never":
+		noColor = true
+	default:
+		dieIf(fmt.Errorf("unknown -color %q, expected auto, always or never", *colorMode))
+	}
+	cm.pinTop = *pinTop
+	cm.intensityByLevel = *intensityByLevel
+	if *dimBelow != "" {
+		if cm.dimBelow = parseLevel(*dimBelow); cm.dimBelow == unknownLevel {
+			dieIf(fmt.Errorf("unknown level %v", *dimBelow))
+		}
+	}
+	getColor := cm.getColor
+	if st != nil {
+		getColor = func(s string) *color.Message {
+			defer st.track(colorStage, time.Now())
+			return cm.getColor(s)
+		}
+	}
+	chipColors, err := parseLevelColors(*levelColors)
+	dieIf(err)
+	expandMessageJSON := expandJSON(getColor, *flattenJSON)
+	colorMessageKV := colorizeKV(getColor, *kvValueTypes)
+	var gradient *severityGradient
+	if *severityGradientSpec != "" {
+		gradient, err = parseSeverityGradient(*severityGradientSpec)
+		dieIf(err)
+	}
+	tmpl, err := newTemplate(*outTemplate, cm, getColor, chipColors, gradient, *flattenJSON)
 	dieIf(err)
 	// then we want to open the out file,
-	r := NewBufferedReader(os.Stdin, 10*time.Millisecond)
-	d := NewEntryDecoder(pattern, r)
+	var in io.Reader = os.Stdin
+	if *followName != "" {
+		in, err = NewFollowReader(*followName, 250*time.Millisecond)
+		dieIf(err)
+	}
+	if *syslogUDP != "" {
+		if *followName != "" || *watch != "" || *listen != "" || flag.NArg() > 0 || *filesFrom != "" || *byteStart > 0 || *byteEnd > 0 {
+			dieIf(fmt.Errorf("-syslog-udp cannot be used with files to process, -F, -watch, -listen, -byte-start or -byte-end"))
+		}
+		in, err = NewSyslogUDPReader(*syslogUDP)
+		dieIf(err)
+	}
+	if paths := flag.Args(); len(paths) > 0 || *filesFrom != "" {
+		if *followName != "" || *watch != "" || *byteStart > 0 || *byteEnd > 0 {
+			dieIf(fmt.Errorf("files to process cannot be used with -F, -watch, -byte-start or -byte-end"))
+		}
+		if *filesFrom != "" {
+			listed, err := readFileList(*filesFrom)
+			dieIf(err)
+			paths = append(paths, listed...)
+		}
+		in = NewFilesReader(paths)
+		if *tail && len(paths) > 0 {
+			last, err := NewTailReader(paths[len(paths)-1], 250*time.Millisecond)
+			dieIf(err)
+			in = io.MultiReader(NewFilesReader(paths[:len(paths)-1]), last)
+		}
+	}
+	if *tail && flag.NArg() == 0 && *filesFrom == "" {
+		dieIf(fmt.Errorf("-f requires a file to follow"))
+	}
+	if *byteStart > 0 || *byteEnd > 0 {
+		f, ok := in.(*os.File)
+		if !ok || *watch != "" {
+			dieIf(fmt.Errorf("-byte-start and -byte-end cannot be used with -F or -watch"))
+		}
+		if _, err := f.Seek(*byteStart, io.SeekStart); err != nil {
+			dieIf(fmt.Errorf("-byte-start and -byte-end require seekable input: %v", err))
+		}
+	}
+	if *dockerFraming {
+		if *byteStart > 0 || *byteEnd > 0 {
+			dieIf(fmt.Errorf("-byte-start and -byte-end cannot be used with -docker-framing"))
+		}
+		in = NewDockerReader(in)
+	}
+	in, err = NewDecodingReader(in, *inputEncoding)
+	dieIf(err)
+	var sum *summary
+	summaryOut := os.Stderr
+	if *summarize {
+		sum = newSummary()
+		if *summaryOutput != "" {
+			summaryOut, err = os.Create(*summaryOutput)
+			dieIf(err)
+		}
+	}
+	var sl *sparklines
+	if *sparkline {
+		sl = newSparklines()
+	}
+	newDecoder := func(r io.Reader, offset int64) decoder {
+		if newLineDecoder != nil {
+			d := newLineDecoder(r, *inputBufferSize)
+			d.SetOffset(offset)
+			if transform != nil {
+				d.Transform(transform)
+			}
+			if *flattenJSON {
+				d.Flatten()
+			}
+			return d
+		}
+		d := NewEntryDecoderSize(pattern, r, *inputBufferSize)
+		d.SetOffset(offset)
+		if *fallbackColorPrefix || *patternStatsFormat != "" {
+			d.KeepUnmatched()
+		}
+		if strictBoundary {
+			d.Strict()
+		}
+		if *indentBlocks {
+			d.IndentBlocks()
+		}
+		if continuation != nil {
+			d.Continuation(continuation)
+		}
+		return d
+	}
+	var reference map[string]struct{}
+	if *diffAgainst != "" {
+		reference, err = loadReference(*diffAgainst, func(r io.Reader) (decoder, error) {
+			r, err := NewDecodingReader(r, *inputEncoding)
+			if err != nil {
+				return nil, err
+			}
+			if newLineDecoder != nil {
+				d := newLineDecoder(r, *inputBufferSize)
+				if transform != nil {
+					d.Transform(transform)
+				}
+				if *flattenJSON {
+					d.Flatten()
+				}
+				return d, nil
+			}
+			d := NewEntryDecoderSize(pattern, r, *inputBufferSize)
+			if strictBoundary {
+				d.Strict()
+			}
+			if *indentBlocks {
+				d.IndentBlocks()
+			}
+			if continuation != nil {
+				d.Continuation(continuation)
+			}
+			return d, nil
+		})
+		dieIf(err)
+	}
 	le := LogEntry{
-		Pattern:     pattern,
-		subexpNames: map[string]int{},
+		Pattern:       pattern,
+		colors:        cm,
+		colorBy:       colorBy,
+		colorField:    *colorByField,
+		contexts:      contexts,
+		categories:    categories,
+		severityGroup: *severityGroup,
+		levelOf:       parseLevel,
+		hueFrom:       *hueFrom,
+		nameKeys:      *nameKeys,
+		subexpNames:   map[string][]int{},
+		timings:       st,
+	}
+	if p.levelOf != nil {
+		le.levelOf = p.levelOf
+	}
+	for _, p := range pads {
+		if _, ok := le.findSubexp(p.group); !ok {
+			dieIf(fmt.Errorf("capture group %v does not exist", p.group))
+		}
 	}
-	w := bufio.NewWriter(os.Stdout)
+	if *colorByExpr != "" {
+		var low, high float64
+		if _, err := fmt.Sscanf(*exprRange, "%g:%g", &low, &high); err != nil || high <= low {
+			dieIf(fmt.Errorf("invalid -expr-range %q, expected LOW:HIGH with LOW < HIGH", *exprRange))
+		}
+		le.expr, err = parseColorExpr(*colorByExpr, low, high)
+		dieIf(err)
+		for _, name := range le.expr.names {
+			if _, ok := le.findSubexp(name); !ok {
+				dieIf(fmt.Errorf("capture group %v does not exist", name))
+			}
+		}
+	}
+	if _, ok := le.findSubexp(*hueFrom); *hueFrom != "" && !ok {
+		dieIf(fmt.Errorf("capture group %v does not exist", *hueFrom))
+	}
+	if gradient != nil {
+		le.gradient = gradient
+		if _, ok := le.findSubexp(gradient.group); !ok {
+			dieIf(fmt.Errorf("capture group %v does not exist", le.gradient.group))
+		}
+	}
+	var ch *changeHighlighter
+	if *highlightChanges != "" {
+		ch = newChangeHighlighter(*highlightChanges)
+		for _, g := range ch.groups {
+			if _, ok := le.findSubexp(g); !ok {
+				dieIf(fmt.Errorf("capture group %v does not exist", g))
+			}
+		}
+	}
+	var na *numericAligner
+	if *alignNumeric != "" {
+		if _, ok := le.findSubexp(*alignNumeric); !ok {
+			dieIf(fmt.Errorf("capture group %v does not exist", *alignNumeric))
+		}
+		na = newNumericAligner()
+	}
+	if _, ok := le.findSubexp(*timestampGroup); (*maskTimestamps || *relativeTimes) && !ok {
+		dieIf(fmt.Errorf("timestamp group %v does not exist", *timestampGroup))
+	}
+	if *maskTimestamps && *relativeTimes {
+		dieIf(fmt.Errorf("-mask-timestamps cannot be combined with -relative-time"))
+	}
+	// firstTime is the timestamp of the first entry, from which -relative-time
+	// measures.
+	var firstTime time.Time
+	out := io.Writer(os.Stdout)
+	if *pauseBuffer <= 0 {
+		dieIf(fmt.Errorf("-pause-buffer must be positive"))
+	}
+	if *pauseKey && isTerminal(os.Stdout) {
+		p := &pauser{w: os.Stdout, limit: *pauseBuffer}
+		dieIf(pauseOnKeypress(p))
+		defer func() {
+			restoreTerminal()
+			dieIf(p.release())
+		}()
+		out = p
+	}
+	if *maxRate < 0 || *maxRateBuffer <= 0 {
+		dieIf(fmt.Errorf("-max-rate must not be negative and -max-rate-buffer must be positive"))
+	}
+	if *maxRate > 0 {
+		rw := newRateWriter(out, *maxRate, *maxRateBuffer)
+		defer func() { dieIf(rw.close()) }()
+		out = rw
+	}
+	if *outputFormat == "html" {
+		if _, ok := htmlThemes[*background]; !ok {
+			dieIf(fmt.Errorf("unknown -background %q, expected dark or light", *background))
+		}
+		hw, err := newHTMLWriter(out, *background)
+		dieIf(err)
+		defer func() { dieIf(hw.close()) }()
+		out = hw
+	}
+	if *outputFormat == "svg" {
+		if _, ok := svgThemes[*background]; !ok {
+			dieIf(fmt.Errorf("unknown -background %q, expected dark or light", *background))
+		}
+		sw := newSVGWriter(out, *background)
+		defer func() { dieIf(sw.close()) }()
+		out = sw
+	}
+	// Output is buffered and flushed when the input idles or ends.
+	w := bufio.NewWriter(out)
 	defer w.Flush()
+	var cw entryWriter
+	switch *outputFormat {
+	case "text", "html", "svg":
+	case "csv":
+		cw, err = newCSVWriter(w, pattern)
+		dieIf(err)
+	case "trace-event":
+		cw = newTraceEventWriter(w, *timestampGroup, *durationGroup, *phaseGroup)
+	default:
+		dieIf(fmt.Errorf("unknown output format %v", *outputFormat))
+	}
+	for _, s := range sinks {
+		dieIf(s.open())
+	}
+	var gb *keyGroups
+	if *groupByKey {
+		if *followName != "" || *watch != "" || *compactRepeats || cw != nil {
+			dieIf(fmt.Errorf("-group-by-key cannot be used with -F, -watch, -compact-repeats or an -output-format other than text"))
+		}
+		gb = newKeyGroups()
+	}
+	var rc *repeatCompactor
+	if *compactRepeats && cw == nil && isTerminal(os.Stdout) {
+		rc = newRepeatCompactor(w)
+	}
+	switch *fullRowBy {
+	case "", "severity", "key":
+	default:
+		dieIf(fmt.Errorf("unknown -full-row %q, expected severity or key", *fullRowBy))
+	}
+	width := terminalWidth()
+	// rowBackground returns the background of the current entry's row, if
+	// it has one.
+	rowBackground := func() (colorful.Color, bool) {
+		switch *fullRowBy {
+		case "severity":
+			if chip, ok := chipColors[le.level()]; ok {
+				return levelRowBackground(chip), true
+			}
+		case "key":
+			if k := le.ColorKey(); k != "" {
+				return cm.rowBackground(k), true
+			}
+		}
+		return colorful.Color{}, false
+	}
+	// postProcess is whether rendered entries must be passed through
+	// processRendered before they are written.
+	postProcess := *fullRowBy != "" || depth != 0 || noColor
+	// processRendered fills the row of a rendered entry with its background,
+	// reduces its colors to -color-depth and strips its escapes if color is
+	// disabled.
+	processRendered := func(b []byte) []byte {
+		if bg, ok := rowBackground(); ok {
+			b = fullRow(b, bg, width)
+		}
+		if depth != 0 {
+			b = downsample(b, depth)
+		}
+		if noColor {
+			b = []byte(stripEscapes(string(b)))
+		}
+		return b
+	}
+	var rendered, sinkRendered bytes.Buffer
+	// isNew is whether the current entry does not appear in the reference.
+	var isNew bool
+	// collapsed is whether the current entry is written beneath the header of
+	// the one before it, whose header is prevHeader.
+	var collapsed bool
+	var prevHeader string
+	render := func(w io.Writer) error {
+		if reference != nil {
+			gutter := unchangedGutter
+			if isNew {
+				gutter = newGutter
+			}
+			if _, err := io.WriteString(w, gutter); err != nil {
+				return err
+			}
+		}
+		if le.Header == "" {
+			return printUnmatched(w, le.Message, getColor)
+		}
+		if collapsed {
+			_, err := io.WriteString(w, indentCollapsed(le.Message))
+			return err
+		}
+		start := time.Now()
+		defer st.track(templateStage, start)
+		return tmpl.Execute(w, &le)
+	}
+	var dw *dedupWindow
+	if *dedupWindowSize < 0 {
+		dieIf(fmt.Errorf("-dedup-window must not be negative"))
+	}
+	if *dedupWindowSize > 0 {
+		dw = newDedupWindow(*dedupWindowSize)
+	}
+	reportRepeats := func(repeated ...*dedupEntry) {
+		if cw != nil {
+			return
+		}
+		if rc != nil && len(repeated) > 0 {
+			dieIf(rc.end())
+		}
+		for _, e := range repeated {
+			dieIf(e.report(w, getColor))
+		}
+	}
+	var ps *patternStats
+	switch *patternStatsFormat {
+	case "":
+	case "table", "json":
+		ps = newPatternStats(pattern.String())
+	default:
+		dieIf(fmt.Errorf("unknown -pattern-stats %q, expected table or json", *patternStatsFormat))
+	}
+	// seeking is whether entries are being skipped until one matches seekTo,
+	// and untilSeen whether an entry has matched untilRE, which ends the input.
+	seeking, untilSeen := seekTo != nil, false
+	// output filters, records and writes the decoded entry.
+	output := func() {
+		st.countEntry()
+		if seeking {
+			if !seekTo.MatchString(le.Header + le.Message) {
+				return
+			}
+			seeking = false
+		} else if untilRE != nil && untilRE.MatchString(le.Header+le.Message) {
+			untilSeen = true
+		}
+		if sess != nil {
+			le.sessionColor = sess.next(le.Header + le.Message)
+		}
+		if ps != nil {
+			ps.add(&le.Entry)
+			if le.Header == "" && !*fallbackColorPrefix {
+				return
+			}
+		}
+		if l := le.level(); l != unknownLevel && l < minLevelValue {
+			return
+		}
+		if window != nil {
+			if ts, _ := le.Match(*timestampGroup); !window.contains(ts) {
+				return
+			}
+		}
+		if len(grep) > 0 || len(grepInvert) > 0 {
+			text := le.Message
+			if *grepWhole {
+				text = le.Header + le.Message
+			}
+			if !grepMatches(text, grep, grepInvert) {
+				return
+			}
+		}
+		if *minStatus > 0 {
+			if s, _ := le.Match("status"); s != "" {
+				if code, err := strconv.Atoi(s); err == nil && code < *minStatus {
+					return
+				}
+			}
+		}
+		if sum != nil {
+			if le.level() >= errorLevel {
+				ts, _ := le.Match(*timestampGroup)
+				sum.add(le.ColorKey(), le.Message, ts)
+			}
+		}
+		if *explain {
+			le.explain(os.Stderr)
+		}
+		if sl != nil {
+			ts, _ := le.Match(*timestampGroup)
+			sl.add(le.ColorKey(), ts)
+		}
+		if reference != nil {
+			_, seen := reference[signature(le.Message)]
+			isNew = !seen
+		}
+		if dw != nil {
+			repeat, evicted := dw.add(le.ColorKey(), le.Message)
+			if evicted != nil {
+				reportRepeats(evicted)
+			}
+			if repeat {
+				return
+			}
+		}
+		var targets []*Sink
+		for _, s := range sinks {
+			if s.accepts(&le) {
+				targets = append(targets, s)
+			}
+		}
+		if na != nil {
+			if v, _ := le.Match(*alignNumeric); v != "" {
+				idx, _ := le.findSubexp(*alignNumeric)
+				le.replaceSubexp(idx, na.align(v))
+			}
+		}
+		for _, p := range pads {
+			if idx, _ := le.findSubexp(p.group); le.matches != nil {
+				v, _ := le.Match(p.group)
+				le.replaceSubexp(idx, p.pad(v))
+			}
+		}
+		if ch != nil && cw == nil {
+			ch.highlight(&le)
+		}
+		if idx, ok := le.findSubexp(*timestampGroup); ok && *maskTimestamps {
+			le.replaceSubexp(idx, "<ts>")
+		}
+		if idx, ok := le.findSubexp(*timestampGroup); ok && *relativeTimes {
+			ts, _ := le.Match(*timestampGroup)
+			if t, ok := parseTimestamp(ts); ok {
+				if firstTime.IsZero() {
+					firstTime = t
+				}
+				le.replaceSubexp(idx, fmt.Sprintf("%+.3fs", t.Sub(firstTime).Seconds()))
+			}
+		}
+		if *expandTabWidth > 0 && cw == nil {
+			le.Message = expandTabs(le.Message, *expandTabWidth)
+		}
+		if *highlightStacksFlag && cw == nil {
+			le.Message = highlightStacks(le.Message)
+		}
+		if *expandJSONMessage && cw == nil {
+			le.Message = expandMessageJSON(le.Message)
+		}
+		if *colorKV && cw == nil {
+			le.Message = colorMessageKV(le.Message)
+		}
+		if len(highlights) > 0 && cw == nil {
+			le.Message = highlightMatches(le.Message, highlights)
+		}
+		if isNew && cw == nil && !noColor {
+			le.Message = wrapSGR(le.Message, sgrNew, sgrDefaultColor)
+		}
+		if cm.dimmed(le.level()) && cw == nil && !noColor {
+			le.Message = wrapSGR(le.Message, sgrDim, sgrNormalIntensity)
+		}
+		if le.Header != "" {
+			cm.count(le.colorMapKey())
+		}
+		if *collapseHeaders {
+			collapsed = le.Header != "" && le.Header == prevHeader
+			prevHeader = le.Header
+		}
+		switch {
+		case cw != nil:
+			dieIf(cw.write(&le))
+		case gb != nil || rc != nil || postProcess:
+			rendered.Reset()
+			dieIf(render(&rendered))
+			b := processRendered(rendered.Bytes())
+			if gb != nil {
+				gb.add(le.ColorKey(), b)
+			} else if rc != nil {
+				dieIf(rc.write(le.ColorKey()+"\x00"+le.Message, b))
+			} else {
+				_, err := w.Write(b)
+				dieIf(err)
+			}
+		default:
+			dieIf(render(w))
+		}
+		if len(targets) > 0 {
+			// Sinks are written the same output as stdout, so the entry is
+			// rendered once for all of them.
+			sinkRendered.Reset()
+			dieIf(render(&sinkRendered))
+			b := sinkRendered.Bytes()
+			if postProcess {
+				b = processRendered(b)
+			}
+			for _, s := range targets {
+				_, err := s.w.Write(b)
+				dieIf(err)
+			}
+		}
+	}
+	// flush writes out the output buffered so far.
+	flush := func() error {
+		if cw != nil {
+			if err := cw.flush(); err != nil {
+				return err
+			}
+		}
+		return w.Flush()
+	}
+	finish := func() {
+		if dw != nil {
+			reportRepeats(dw.flush()...)
+		}
+		if gb != nil {
+			dieIf(gb.write(w, getColor))
+		}
+		for _, s := range sinks {
+			dieIf(s.close())
+		}
+		if rc != nil {
+			dieIf(rc.end())
+		}
+		dieIf(flush())
+		if *dumpColorMap != "" {
+			dieIf(cm.dump(*dumpColorMap, false))
+		}
+		if *colorCache != "" {
+			dieIf(cm.dump(*colorCache, true))
+		}
+		st.report(os.Stderr)
+		if ps != nil {
+			dieIf(ps.report(os.Stderr, *patternStatsFormat))
+		}
+		if sl != nil {
+			sl.report(os.Stderr, getColor)
+		}
+		if *legend {
+			cm.legend(os.Stderr)
+		}
+		if sum != nil {
+			sum.report(summaryOut, getColor)
+			if summaryOut != os.Stderr {
+				dieIf(summaryOut.Close())
+			}
+		}
+	}
+	if *debugMatchFlag {
+		dieIf(debugMatch(os.Stdout, in, pattern, cm.getColor))
+		return
+	}
+	if len(testEntries) > 0 {
+		for _, s := range testEntries {
+			if !strings.HasSuffix(s, "\n") {
+				s += "\n"
+			}
+			d := newDecoder(strings.NewReader(s), 0)
+			matched := false
+			for {
+				err := d.Decode(&le.Entry)
+				if err == io.EOF {
+					break
+				}
+				dieIf(err)
+				matched = matched || le.Header != ""
+				output()
+			}
+			if !matched {
+				fmt.Fprintf(os.Stderr, "logcolor: -test-entry %q does not match the header pattern\n", strings.TrimSuffix(s, "\n"))
+			}
+		}
+		finish()
+		return
+	}
+	stop := notifyStop(*teardownTimeout, *maxRuntime)
+	if *listen != "" {
+		if seekTo != nil || untilRE != nil {
+			dieIf(fmt.Errorf("-seek-to and -until-pattern cannot be used with -listen"))
+		}
+		dieIf(serve(*listen, &streamColorizer{
+			entry:          le,
+			colors:         cm,
+			template:       *outTemplate,
+			chipColors:     chipColors,
+			bufferSize:     *inputBufferSize,
+			keepUnmatched:  *fallbackColorPrefix,
+			strict:         strictBoundary,
+			indentBlocks:   *indentBlocks,
+			continuation:   continuation,
+			newLineDecoder: newLineDecoder,
+			flattenJSON:    *flattenJSON,
+			transform:      transform,
+		}, stop))
+		return
+	}
+	// decodeAll decodes and outputs every entry of a file.
+	decodeAll := func(f io.Reader) error {
+		if *dockerFraming {
+			f = NewDockerReader(f)
+		}
+		f, err := NewDecodingReader(f, *inputEncoding)
+		if err != nil {
+			return err
+		}
+		d := newDecoder(f, 0)
+		for {
+			if stopped(stop) {
+				return errStopped
+			}
+			switch err := d.Decode(&le.Entry); err {
+			case nil:
+				output()
+				if untilSeen {
+					flush()
+					return errStopped
+				}
+			case io.EOF:
+				return flush()
+			default:
+				return err
+			}
+		}
+	}
+	if *watch != "" {
+		if err := watchFile(*watch, 250*time.Millisecond, stop, decodeAll); err != errStopped {
+			dieIf(err)
+		}
+		finish()
+		return
+	}
+	r := NewBufferedReader(in, 10*time.Millisecond)
+	// When following a file the last entry may still be being written when the
+	// input idles, so it is held back until the next entry begins.
+	following := *followName != "" || *tail
+	d := newDecoder(r, *byteStart)
+	if following {
+		d.HoldPartial()
+	}
 	for {
-		switch err := d.Decode(&le.Entry); err {
+		start := time.Now()
+		err := d.Decode(&le.Entry)
+		st.track(decodeStage, start)
+		switch err {
 		case nil:
-			err := tmpl.Execute(os.Stdout, &le)
-			dieIf(err)
+			if *byteEnd > 0 && le.Offset >= *byteEnd {
+				finish()
+				return
+			}
+			output()
+			if untilSeen || stopped(stop) {
+				finish()
+				return
+			}
 		case io.EOF:
-			d = NewEntryDecoder(pattern, r)
+			dieIf(flush())
+			for _, s := range sinks {
+				dieIf(s.w.Flush())
+			}
+			held := d.Held()
+			if stopped(stop) {
+				// Output the held entry, which is as complete as it will be.
+				d = newDecoder(bytes.NewReader(held), d.Offset()-int64(len(held)))
+				for d.Decode(&le.Entry) == nil {
+					output()
+				}
+				finish()
+				return
+			}
+			next := r
+			if len(held) > 0 {
+				next = io.MultiReader(bytes.NewReader(held), r)
+			}
+			d = newDecoder(next, d.Offset()-int64(len(held)))
+			if following {
+				d.HoldPartial()
+			}
 			continue
 		case io.ErrUnexpectedEOF:
+			finish()
 			return
 		default:
+			// Write out the entries which preceded the error.
+			flush()
 			dieIf(err)
 		}
 	}
 }
 
+// readFileList reads the non-empty lines of the file at path, or of stdin if
+// path is -.
+func readFileList(path string) ([]string, error) {
+	f := os.Stdin
+	if path != "-" {
+		var err error
+		if f, err = os.Open(path); err != nil {
+			return nil, err
+		}
+		defer f.Close()
+	}
+	var paths []string
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		if line := strings.TrimRight(s.Text(), "\r"); line != "" {
+			paths = append(paths, line)
+		}
+	}
+	return paths, s.Err()
+}
+
+// newTemplate parses the output template with the template functions which
+// color text using cm. Keys are colored by getColor, which is cm.getColor or a
+// wrapper of it. The gradient of -severity-gradient may be nil. flattenJSON is
+// -flatten-json.
+func newTemplate(
+	text string,
+	cm *colorMap,
+	getColor func(string) *color.Message,
+	chipColors map[level]colorful.Color,
+	gradient *severityGradient,
+	flattenJSON bool,
+) (*template.Template, error) {
+	sevColor := severityColor(getColor)
+	return template.New("logs").Funcs(template.FuncMap{
+		"color":            getColor,
+		"statuscolor":      statusColor,
+		"severityColor":    sevColor,
+		"severitycolor":    sevColor,
+		"levelchip":        levelChip(chipColors),
+		"expandjson":       expandJSON(getColor, flattenJSON),
+		"shortid":          cm.shortID,
+		"bg":               cm.background,
+		"severitygradient": gradient.templateColor,
+		"bold":             bold,
+		"dim":              dim,
+		"underline":        underline,
+
+		"humanbytes":    humanBytes,
+		"humanduration": humanDuration,
+		"visiblelen":    visibleWidth,
+		"parseTime":     parseTime,
+		"timefmt":       timeFormat,
+	}).Parse(text)
+}
+
 func dieIf(err error) {
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err)
+		restoreTerminal()
 		os.Exit(1)
 	}
 }
 
+// printUnmatched writes text which did not match the header pattern to w,
+// coloring each line by its first whitespace-delimited field.
+func printUnmatched(w io.Writer, s string, getColor func(string) *color.Message) error {
+	for _, line := range strings.SplitAfter(s, "\n") {
+		start := strings.IndexFunc(line, func(r rune) bool { return !unicode.IsSpace(r) })
+		if start < 0 {
+			if _, err := io.WriteString(w, line); err != nil {
+				return err
+			}
+			continue
+		}
+		end := strings.IndexFunc(line[start:], unicode.IsSpace)
+		if end < 0 {
+			end = len(line)
+		} else {
+			end += start
+		}
+		field := line[start:end]
+		if _, err := fmt.Fprint(w, line[:start], getColor(field).Sprint(field), line[end:]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // LogEntry is the root element passed to the output template
 type LogEntry struct {
 	Entry
 	// Pattern is the Regexp which captured the header.
 	Pattern *regexp.Regexp
 
-	subexpNames map[string]int
+	colors        *colorMap
+	colorBy       *regexp.Regexp
+	colorField    string
+	contexts      *contextKeys
+	expr          *colorExpr
+	gradient      *severityGradient
+	categories    categoryFlag
+	sessionColor  *color.Message
+	severityGroup string
+	// timings, if set, records the time spent in Color for -self-timing.
+	timings *timings
+	// levelOf parses the value of the severity group.
+	levelOf     func(string) level
+	hueFrom     string
+	nameKeys    bool
+	subexpNames map[string][]int
+}
+
+// ColorName returns a memorable name for the entry's ColorKey if -name-keys
+// is set, and is otherwise empty. Like colors, names are derived from a hash of
+// the key, so distinct keys may share a name.
+func (le *LogEntry) ColorName() string {
+	if !le.nameKeys {
+		return ""
+	}
+	return le.colors.colorName(le.colorMapKey())
+}
+
+// Color returns the color of the entry's ColorKey, adjusted for the severity
+// of the entry if -intensity-by-level or -dim-below are set. If
+// -severity-gradient is set and the entry has a numeric severity, the color of
+// its band is returned instead, and if -color-by-expr is set and has a value
+// for the entry, its color takes precedence over both. That is
+// in turn overridden by the color of the first -category which matches the
+// entry and then by the color of the -session-start session it is in.
+func (le *LogEntry) Color() *color.Message {
+	defer le.timings.track(colorStage, time.Now())
+	if le.sessionColor != nil {
+		return le.sessionColor
+	}
+	if col, ok := le.categories.match(le.Header + le.Message); ok {
+		return col
+	}
+	if le.expr != nil {
+		if col, ok := le.expr.color(le); ok {
+			return col
+		}
+	}
+	if le.gradient != nil {
+		s, _ := le.Match(le.gradient.group)
+		if col, ok := le.gradient.color(s); ok {
+			return col
+		}
+	}
+	return le.colors.getLevelColor(le.colorMapKey(), le.level())
+}
+
+// colorMapKey returns the key by which the entry is colored by the colorMap,
+// which is its ColorKey qualified by its -hue-from tenant, if it has one.
+func (le *LogEntry) colorMapKey() string {
+	k := le.ColorKey()
+	if le.hueFrom == "" || k == "" {
+		return k
+	}
+	if tenant, _ := le.Match(le.hueFrom); tenant != "" {
+		return tenantKey(tenant, k)
+	}
+	return k
+}
+
+func (le *LogEntry) level() level {
+	sev, _ := le.Match(le.severityGroup)
+	return le.levelOf(sev)
+}
+
+// ColorKey returns the string from which the color of the entry is derived.
+// By default it is the -color-by-field capture, which defaults to "prefix". If a -color-by-regex pattern is set it
+// is the first submatch of that pattern against the entry, or the whole match
+// if the pattern has no groups, and empty if the pattern does not match. If a
+// -context-regex pattern is set, entries which share a context id share the key
+// of the first of them.
+func (le *LogEntry) ColorKey() string {
+	if le.contexts == nil {
+		return le.ownColorKey()
+	}
+	return le.contexts.resolve(le.Header+le.Message, le.ownColorKey())
+}
+
+// ownColorKey returns the color key of the entry without regard to context.
+func (le *LogEntry) ownColorKey() string {
+	if le.colorBy == nil {
+		k, _ := le.Match(le.colorField)
+		return k
+	}
+	m := le.colorBy.FindStringSubmatch(le.Header + le.Message)
+	if len(m) == 0 {
+		return ""
+	}
+	for _, k := range m[1:] {
+		if k != "" {
+			return k
+		}
+	}
+	return m[0]
 }
 
 func (le *LogEntry) Match(capture string) (string, error) {
+	if le.fields != nil {
+		return le.Field(capture), nil
+	}
 	idx, ok := le.findSubexp(capture)
 	if !ok {
 		return "", fmt.Errorf("no capture group %v does not exist", capture)
 	}
-
+	if le.matches == nil || le.matches[2*idx] < 0 {
+		// The group did not participate in the match.
+		return "", nil
+	}
 	return le.Header[le.matches[2*idx]:le.matches[(2*idx)+1]], nil
 }
 
-func (le *LogEntry) findSubexp(capture string) (int, bool) {
-	if idx, ok := le.subexpNames[capture]; ok {
-		return idx, ok
+// replaceSubexp replaces the text captured by the subexpression idx in the
+// header with s, adjusting the offsets of the other captures to match.
+func (le *LogEntry) replaceSubexp(idx int, s string) {
+	if le.matches == nil {
+		return
 	}
-	for i, n := range le.Pattern.SubexpNames() {
-		if n == capture {
-			le.subexpNames[n] = i
-			return i, true
+	start, end := le.matches[2*idx], le.matches[(2*idx)+1]
+	if start < 0 {
+		return
+	}
+	le.Header = le.Header[:start] + s + le.Header[end:]
+	delta := len(s) - (end - start)
+	for i, m := range le.matches {
+		if m >= end {
+			le.matches[i] = m + delta
 		}
 	}
-	return -1, false
 }
 
-type colorMap map[string]*color.Message
-
-func (m *colorMap) getColor(s string) *color.Message {
-	if col, ok := (*m)[s]; ok {
-		return col
+// findSubexp returns the index of the subexpression with the given name. If
+// several subexpressions share the name, as they may in the alternatives of a
+// pattern which matches several formats, the first which participated in the
+// match of the current entry is returned.
+func (le *LogEntry) findSubexp(capture string) (int, bool) {
+	idxs, ok := le.subexpNames[capture]
+	if !ok {
+		for i, n := range le.Pattern.SubexpNames() {
+			if n == capture {
+				idxs = append(idxs, i)
+			}
+		}
+		le.subexpNames[capture] = idxs
+	}
+	if len(idxs) == 0 {
+		return -1, false
+	}
+	if le.matches != nil {
+		for _, i := range idxs {
+			if le.matches[2*i] >= 0 {
+				return i, true
+			}
+		}
 	}
-	sum := md5.Sum([]byte(s))
-	f1 := float64(binary.BigEndian.Uint64(sum[8:])) / math.MaxUint64
-	f2 := float64(binary.BigEndian.Uint64(sum[:8])) / math.MaxUint64
-	f3 := float64(binary.LittleEndian.Uint64(sum[4:])) / math.MaxUint64
-	h := 360 * f1
-	c := .33 + .2*f2
-	l := .6 + .30*f3
-	col := color.Color(colorful.Hcl(h, c, l).Clamped().RGB255())
-	(*m)[s] = col
-	return col
+	return idxs[0], true
 }
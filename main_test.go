@@ -0,0 +1,261 @@
+// Copyright 2018 Andrew Werner, All Rights Reserved.
+
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "Rewrite the golden files in testdata.")
+
+// TestMain runs main in place of the tests when the test binary is executed
+// by runMain.
+func TestMain(m *testing.M) {
+	if os.Getenv("LOGCOLOR_TEST_MAIN") != "" {
+		main()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// runMain runs logcolor with the given arguments and input and returns what it
+// writes to stdout.
+func runMain(t *testing.T, input string, args ...string) string {
+	t.Helper()
+	return runMainEnv(t, nil, input, args...)
+}
+
+// runMainEnv is like runMain but adds env to the environment of logcolor.
+func runMainEnv(t *testing.T, env []string, input string, args ...string) string {
+	t.Helper()
+	out, _ := runMainOutput(t, env, input, args...)
+	return out
+}
+
+// runMainOutput is like runMainEnv but also returns what logcolor writes to
+// stderr.
+func runMainOutput(t *testing.T, env []string, input string, args ...string) (stdout, stderr string) {
+	t.Helper()
+	cmd := exec.Command(os.Args[0], args...)
+	cmd.Env = append(append(os.Environ(), "LOGCOLOR_TEST_MAIN=1"), env...)
+	cmd.Stdin = strings.NewReader(input)
+	var errBuf bytes.Buffer
+	cmd.Stderr = &errBuf
+	out, err := cmd.Output()
+	if err != nil {
+		t.Fatalf("logcolor %v: %v\n%s", strings.Join(args, " "), err, errBuf.Bytes())
+	}
+	return string(out), errBuf.String()
+}
+
+// readFixture returns the contents of the named file in testdata.
+func readFixture(t *testing.T, name string) string {
+	t.Helper()
+	b, err := ioutil.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+// checkGolden compares got to the named golden file in testdata, or with
+// -update, rewrites the file.
+func checkGolden(t *testing.T, name, got string) {
+	t.Helper()
+	path := filepath.Join("testdata", name)
+	if *update {
+		if err := ioutil.WriteFile(path, []byte(got), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	if exp := readFixture(t, name); got != exp {
+		t.Fatalf("output differs from %v:\ngot:\n%s\nexpected:\n%s", path, got, exp)
+	}
+}
+
+func TestOutputFormats(t *testing.T) {
+	in := readFixture(t, "glog.log")
+	for _, format := range []string{"text", "html", "svg", "trace-event"} {
+		t.Run(format, func(t *testing.T) {
+			out := runMain(t, in, "-output-format", format, "-color", "always")
+			checkGolden(t, "glog."+format+".golden", out)
+		})
+	}
+}
+
+// TestOutputIsComplete checks that output written through the buffered writer
+// is written in order and flushed in full when the input ends.
+func TestOutputIsComplete(t *testing.T) {
+	var in strings.Builder
+	for i := 0; i < 20000; i++ {
+		fmt.Fprintf(&in, "n%d> I240305 17:21:09.%06d 1 main.go:1 entry %d\n", i%3, i, i)
+	}
+	// With color disabled, the default template reproduces the input.
+	out := runMain(t, in.String(), "-color", "never")
+	if out != in.String() {
+		got, want := strings.Split(out, "\n"), strings.Split(in.String(), "\n")
+		for i := range want {
+			if i >= len(got) || got[i] != want[i] {
+				t.Fatalf("got %d lines, first difference at line %d", len(got), i+1)
+			}
+		}
+		t.Fatalf("got %d lines, expected %d", len(got), len(want))
+	}
+}
+
+func TestBoundaryFlag(t *testing.T) {
+	in := "[a] first, see [b] for more\n"
+	for boundary, exp := range map[string]string{
+		"lazy":   "[a] |first, see [b] |for more\n",
+		"strict": "[a] |first, see [b] for more\n",
+	} {
+		got := runMain(t, in, "-boundary", boundary, "-log-header-pattern", `(?P<prefix>\[\w+\]) `,
+			"-output-template", "{{ .Header }}|{{ .Message }}", "-color", "never")
+		if got != exp {
+			t.Errorf("-boundary %v: got %q, expected %q", boundary, got, exp)
+		}
+	}
+}
+
+func TestNoColor(t *testing.T) {
+	in := readFixture(t, "glog.log")
+	args := []string{"-output-format", "html", "-output-template", `{{ .Match "header" | bold }} {{ .Match "severity" | levelchip }}{{ .Message | dim }}`}
+	for _, c := range []struct {
+		env     string
+		args    []string
+		colored bool
+	}{
+		{"NO_COLOR=1", nil, false},
+		{"NO_COLOR=", nil, true},
+		{"NO_COLOR=1", []string{"-color", "always"}, true},
+	} {
+		out := runMainEnv(t, []string{c.env}, in, append(args, c.args...)...)
+		if colored := strings.Contains(out, "<span"); colored != c.colored {
+			t.Errorf("%v %v: colored = %v, expected %v:\n%s", c.env, c.args, colored, c.colored, out)
+		}
+		if strings.Contains(out, "\x1b[") {
+			t.Errorf("%v %v: output contains escape sequences:\n%s", c.env, c.args, out)
+		}
+	}
+}
+
+func TestIndentBlocks(t *testing.T) {
+	out := runMain(t, readFixture(t, "traceback.log"), "-color", "never", "-indent-blocks",
+		"-log-header-pattern", testPythonPattern.String(), "-output-template", "{{ .Header }}|{{ .Message }}")
+	checkGolden(t, "traceback.indent-blocks.golden", out)
+}
+
+func TestContinuationPatternFlag(t *testing.T) {
+	in := "[a] first\n| more\nstray line\n[b] second\n"
+	args := []string{"-continuation-pattern", `^\|`, "-log-header-pattern", `(?P<prefix>\[\w+\]) `,
+		"-output-template", "{{ .Header }}|{{ .Message }}", "-color", "never"}
+	if got, exp := runMain(t, in, args...), "[a] |first\n| more\n[b] |second\n"; got != exp {
+		t.Errorf("got %q, expected %q", got, exp)
+	}
+	if got, exp := runMain(t, in, append(args, "-fallback-color-prefix")...), "[a] |first\n| more\nstray line\n[b] |second\n"; got != exp {
+		t.Errorf("-fallback-color-prefix: got %q, expected %q", got, exp)
+	}
+}
+
+// TestCRLF checks that input with CRLF line endings is written as it would be
+// with LF line endings.
+func TestCRLF(t *testing.T) {
+	for _, c := range []struct {
+		fixture string
+		args    []string
+	}{
+		{"glog.log", nil},
+		{"glog.log", []string{"-output-format", "html"}},
+		{"glog.log", []string{"-fallback-color-prefix", "-highlight-stacks"}},
+		{"otel.jsonl", []string{"-preset", "otel"}},
+		{"logfmt.log", []string{"-colorize-kv"}},
+	} {
+		in := readFixture(t, c.fixture)
+		args := append([]string{"-color", "always"}, c.args...)
+		exp := runMain(t, in, args...)
+		got := runMain(t, strings.Replace(in, "\n", "\r\n", -1), args...)
+		if strings.Contains(got, "\r") {
+			t.Errorf("%v %v: output contains carriage returns:\n%q", c.fixture, c.args, got)
+		} else if got != exp {
+			t.Errorf("%v %v: got:\n%s\nexpected:\n%s", c.fixture, c.args, got, exp)
+		}
+	}
+}
+
+func TestTimeWindowFlags(t *testing.T) {
+	in := readFixture(t, "glog.log")
+	args := []string{"-color", "never", "-output-template", `{{ .Match "time" }}{{ "\n" }}`}
+	for _, c := range []struct {
+		args []string
+		exp  string
+	}{
+		{[]string{"-since", "17:21:10", "-until", "17:21:11.5"}, "240305 17:21:10.201377\n240305 17:21:11.254810\n"},
+		{[]string{"-until", "17:21:09.2"}, "240305 17:21:09.123456\n240305 17:21:09.130012\n"},
+		{[]string{"-until-pattern", "slow disk"}, "240305 17:21:09.123456\n240305 17:21:09.130012\n240305 17:21:10.201377\n"},
+	} {
+		if got := runMain(t, in, append(args, c.args...)...); got != c.exp {
+			t.Errorf("%v: got %q, expected %q", c.args, got, c.exp)
+		}
+	}
+}
+
+// TestSinkOutputIsProcessed checks that sinks and stdout are written the same
+// output, which respects -color and -color-depth.
+func TestSinkOutputIsProcessed(t *testing.T) {
+	dir, err := ioutil.TempDir("", "logcolor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	in := readFixture(t, "glog.log")
+	reference := filepath.Join(dir, "reference.log")
+	if err := ioutil.WriteFile(reference, []byte(in[:strings.Index(in, "n3>")]), 0644); err != nil {
+		t.Fatal(err)
+	}
+	sink := filepath.Join(dir, "sink.log")
+	for _, c := range []struct {
+		args    []string
+		escapes bool
+	}{
+		{[]string{"-color", "never"}, false},
+		{[]string{"-color", "always", "-color-depth", "16"}, true},
+	} {
+		args := append([]string{"-diff-against", reference, "-dim-below", "warning", "-sink", "file=" + sink}, c.args...)
+		out := runMain(t, in, args...)
+		b, err := ioutil.ReadFile(sink)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != out {
+			t.Errorf("%v: sink differs from stdout:\n%q\n%q", c.args, b, out)
+		}
+		if escapes := strings.Contains(out, "\x1b["); escapes != c.escapes {
+			t.Errorf("%v: output contains escapes = %v, expected %v:\n%q", c.args, escapes, c.escapes, out)
+		}
+		if strings.Contains(out, "38;2;") {
+			t.Errorf("%v: output contains truecolor escapes:\n%q", c.args, out)
+		}
+	}
+}
+
+func TestLongLine(t *testing.T) {
+	in := readFixture(t, "long-line.jsonl")
+	for _, format := range []string{"json", "logfmt"} {
+		out := runMain(t, in, "-input-format", format, "-color", "never")
+		if lines := strings.Count(out, "\n"); lines != 3 {
+			t.Errorf("-input-format %v: got %d lines, expected 3", format, lines)
+		}
+		if !strings.Contains(out, "after") {
+			t.Errorf("-input-format %v: the line after the long line is missing", format)
+		}
+	}
+}
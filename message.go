@@ -0,0 +1,318 @@
+// Copyright 2018 Andrew Werner, All Rights Reserved.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/wayneashleyberry/truecolor/pkg/color"
+)
+
+// This file contains transformations of the message of an entry which are
+// applied before it is rendered.
+
+// expandJSON returns a function which finds a JSON object in a message and
+// replaces it with its fields rendered as key=value pairs in the order of
+// their keys, coloring each key by its name. Nested values are rendered as
+// compact JSON, or if flatten is set, as pairs of their own named by their
+// dotted paths. Messages which do not contain a JSON object are returned
+// unchanged.
+func expandJSON(getColor func(string) *color.Message, flatten bool) func(string) string {
+	return func(msg string) string {
+		start := strings.IndexByte(msg, '{')
+		end := strings.LastIndexByte(msg, '}')
+		if start < 0 || end < start {
+			return msg
+		}
+		var obj map[string]json.RawMessage
+		if err := json.Unmarshal([]byte(msg[start:end+1]), &obj); err != nil {
+			return msg
+		}
+		if flatten {
+			obj = flattenRaw(obj)
+		}
+		keys := make([]string, 0, len(obj))
+		for k := range obj {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		var buf strings.Builder
+		buf.WriteString(msg[:start])
+		for i, k := range keys {
+			if i > 0 {
+				buf.WriteByte(' ')
+			}
+			fmt.Fprintf(&buf, "%s=%s", getColor(k).Sprint(k), jsonValue(obj[k]))
+		}
+		buf.WriteString(msg[end+1:])
+		return buf.String()
+	}
+}
+
+// flattenRaw is like flattenFields for undecoded values.
+func flattenRaw(obj map[string]json.RawMessage) map[string]json.RawMessage {
+	flat := make(map[string]json.RawMessage, len(obj))
+	var add func(prefix string, v json.RawMessage)
+	add = func(prefix string, v json.RawMessage) {
+		var nested map[string]json.RawMessage
+		var elems []json.RawMessage
+		switch {
+		case json.Unmarshal(v, &nested) == nil && len(nested) > 0:
+			for k, v := range nested {
+				add(prefix+"."+k, v)
+			}
+		case json.Unmarshal(v, &elems) == nil && len(elems) > 0:
+			for i, v := range elems {
+				add(prefix+"."+strconv.Itoa(i), v)
+			}
+		default:
+			flat[prefix] = v
+		}
+	}
+	for k, v := range obj {
+		add(k, v)
+	}
+	return flat
+}
+
+// jsonValue renders a JSON value for expandJSON. Strings are unquoted unless
+// they contain spaces and other values are compacted.
+func jsonValue(v json.RawMessage) string {
+	var s string
+	if err := json.Unmarshal(v, &s); err == nil {
+		if strings.ContainsAny(s, " \t\n") || s == "" {
+			return fmt.Sprintf("%q", s)
+		}
+		return s
+	}
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, v); err != nil {
+		return string(v)
+	}
+	return buf.String()
+}
+
+// kvTypeColors are the colors of the values of key=value pairs by their type
+// for -kv-value-types.
+var (
+	kvNumberColor = color.Color(0xb5, 0xce, 0xa8)
+	kvBoolColor   = color.Color(0x56, 0x9c, 0xd6)
+	kvStringColor = color.Color(0xce, 0x91, 0x78)
+)
+
+// colorizeKV returns a function which colors the key of each key=value pair in
+// a message by its name, as is done by expandJSON, so that a field has the
+// same color in every entry. A pair begins a message or follows whitespace,
+// and its value runs to the next whitespace unless it is quoted, in which case
+// it may contain spaces and quotes escaped with a backslash. If valueTypes is
+// set, values are also colored as numbers, booleans or null, or quoted
+// strings.
+func colorizeKV(getColor func(string) *color.Message, valueTypes bool) func(string) string {
+	return func(msg string) string {
+		if noColor || strings.IndexByte(msg, '=') < 0 {
+			return msg
+		}
+		var buf strings.Builder
+		for i := 0; i < len(msg); {
+			if i > 0 && !isKVSpace(msg[i-1]) || !isKVKeyStart(msg[i]) {
+				buf.WriteByte(msg[i])
+				i++
+				continue
+			}
+			k := i + 1
+			for k < len(msg) && isKVKey(msg[k]) {
+				k++
+			}
+			if k == len(msg) || msg[k] != '=' {
+				buf.WriteString(msg[i:k])
+				i = k
+				continue
+			}
+			v, end := k+1, kvValueEnd(msg, k+1)
+			buf.WriteString(getColor(msg[i:k]).Sprint(msg[i:k]))
+			buf.WriteByte('=')
+			if value := msg[v:end]; valueTypes && value != "" {
+				buf.WriteString(kvValueColor(value).Sprint(value))
+			} else {
+				buf.WriteString(value)
+			}
+			i = end
+		}
+		return buf.String()
+	}
+}
+
+// kvValueEnd returns the offset in msg of the end of the value beginning at
+// i. A quoted value without a closing quote is taken to be unquoted.
+func kvValueEnd(msg string, i int) int {
+	if i < len(msg) && msg[i] == '"' {
+		for j := i + 1; j < len(msg) && msg[j] != '\n'; j++ {
+			switch msg[j] {
+			case '\\':
+				j++
+			case '"':
+				return j + 1
+			}
+		}
+	}
+	for i < len(msg) && !isKVSpace(msg[i]) && msg[i] != '\x1b' {
+		i++
+	}
+	return i
+}
+
+// kvValueColor returns the color of a value by its type.
+func kvValueColor(v string) *color.Message {
+	switch {
+	case v[0] == '"':
+		return kvStringColor
+	case v == "true" || v == "false" || v == "null" || v == "nil":
+		return kvBoolColor
+	}
+	if _, err := strconv.ParseFloat(v, 64); err == nil {
+		return kvNumberColor
+	}
+	return plainColor
+}
+
+func isKVSpace(c byte) bool { return c == ' ' || c == '\t' || c == '\n' }
+
+func isKVKeyStart(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+func isKVKey(c byte) bool {
+	return isKVKeyStart(c) || c >= '0' && c <= '9' || c == '.' || c == '-' || c == '/'
+}
+
+// collapsedIndent prefixes each line of the messages written beneath the
+// header of a previous entry by -collapse-identical-headers.
+const collapsedIndent = "    "
+
+// indentCollapsed returns msg without its leading spaces and with each of its
+// lines indented by collapsedIndent.
+func indentCollapsed(msg string) string {
+	msg = strings.TrimLeft(msg, " ")
+	body := strings.TrimRight(msg, "\n")
+	return collapsedIndent + strings.Replace(body, "\n", "\n"+collapsedIndent, -1) + msg[len(body):]
+}
+
+// expandTabs replaces each tab in msg with the spaces needed to reach the next
+// multiple of tabWidth columns. Columns are counted from the start of each
+// line of the message and ANSI escape sequences, which occupy no columns, are
+// copied unchanged.
+func expandTabs(msg string, tabWidth int) string {
+	if strings.IndexByte(msg, '\t') < 0 {
+		return msg
+	}
+	var buf strings.Builder
+	col := 0
+	for i := 0; i < len(msg); {
+		switch c := msg[i]; {
+		case c == '\x1b':
+			n := escapeLen(msg[i:])
+			buf.WriteString(msg[i : i+n])
+			i += n
+			continue
+		case c == '\t':
+			n := tabWidth - col%tabWidth
+			buf.WriteString(strings.Repeat(" ", n))
+			col += n
+		case c == '\n':
+			buf.WriteByte(c)
+			col = 0
+		default:
+			buf.WriteByte(c)
+			// Count the first byte of each UTF-8 sequence.
+			if c&0xC0 != 0x80 {
+				col++
+			}
+		}
+		i++
+	}
+	return buf.String()
+}
+
+// escapeLen returns the length of the ANSI CSI escape sequence at the start of
+// s, or 1 if s starts with an escape which does not begin such a sequence.
+func escapeLen(s string) int {
+	if len(s) < 2 || s[1] != '[' {
+		return 1
+	}
+	for i := 2; i < len(s); i++ {
+		if s[i] >= 0x40 && s[i] <= 0x7e {
+			return i + 1
+		}
+	}
+	return len(s)
+}
+
+var (
+	goroutineHeaderRE = regexp.MustCompile(`^goroutine \d+ \[[^\]]*\]:$`)
+	stackFuncRE       = regexp.MustCompile(`^(created by )?([^\s(]+(?:\(\*[^\s)]+\)[^\s(]*)*)(\(.*\))?( in goroutine \d+)?$`)
+	stackFileRE       = regexp.MustCompile(`^(\t)(\S+?):(\d+)(.*)$`)
+
+	stackHeaderColor = color.Color(0xce, 0x93, 0xd8)
+	stackFuncColor   = color.Color(0x4f, 0xc3, 0xf7)
+	stackPathColor   = color.Color(0x9e, 0x9e, 0x9e)
+	stackLineColor   = color.Color(0xff, 0xca, 0x28)
+)
+
+// highlightStacks colors the Go stack traces in msg, as written by a panic or
+// runtime.Stack. Each trace begins with a goroutine header line and is
+// followed by pairs of function and file:line lines until a line which does
+// not fit that structure. The function names, file paths and line numbers are
+// each given a distinct color.
+func highlightStacks(msg string) string {
+	if !strings.Contains(msg, "goroutine ") {
+		return msg
+	}
+	var buf strings.Builder
+	inStack := false
+	for _, line := range strings.SplitAfter(msg, "\n") {
+		text := strings.TrimSuffix(line, "\n")
+		nl := line[len(text):]
+		switch {
+		case goroutineHeaderRE.MatchString(text):
+			inStack = true
+			buf.WriteString(stackHeaderColor.Sprint(text) + nl)
+			continue
+		case !inStack:
+		case stackFileRE.MatchString(text):
+			m := stackFileRE.FindStringSubmatch(text)
+			buf.WriteString(m[1] + stackPathColor.Sprint(m[2]) + ":" + stackLineColor.Sprint(m[3]) + m[4] + nl)
+			continue
+		case stackFuncRE.MatchString(text):
+			m := stackFuncRE.FindStringSubmatch(text)
+			buf.WriteString(m[1] + stackFuncColor.Sprint(m[2]) + m[3] + m[4] + nl)
+			continue
+		default:
+			inStack = false
+		}
+		buf.WriteString(line)
+	}
+	return buf.String()
+}
+
+// stripEscapes returns s without its escape sequences.
+func stripEscapes(s string) string {
+	if strings.IndexByte(s, '\x1b') < 0 {
+		return s
+	}
+	var buf strings.Builder
+	for i := 0; i < len(s); {
+		if s[i] == '\x1b' {
+			i += escapeLen(s[i:])
+			continue
+		}
+		buf.WriteByte(s[i])
+		i++
+	}
+	return buf.String()
+}
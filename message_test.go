@@ -0,0 +1,108 @@
+// Copyright 2018 Andrew Werner, All Rights Reserved.
+
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/wayneashleyberry/truecolor/pkg/color"
+)
+
+func TestHighlightStacks(t *testing.T) {
+	msg := readFixture(t, "panic.log")
+	got := highlightStacks(msg)
+	if stripped := stripEscapes(got); stripped != msg {
+		t.Fatalf("highlighting changed the text of the message:\n%s", stripped)
+	}
+	for _, exp := range []string{
+		stackHeaderColor.Sprint("goroutine 42 [running]:") + "\n",
+		stackFuncColor.Sprint("main.(*Handler).ServeHTTP") + "(0x0, {0x7f3e20, 0xc0001a2000}, 0xc000190100)\n",
+		"\t" + stackPathColor.Sprint("/src/app/handler.go") + ":" + stackLineColor.Sprint("57") + " +0x2f\n",
+		"created by " + stackFuncColor.Sprint("net/http.(*Server).Serve") + " in goroutine 1\n",
+		stackFuncColor.Sprint("main.main") + "()\n",
+	} {
+		if !strings.Contains(got, exp) {
+			t.Errorf("expected output to contain %q", exp)
+		}
+	}
+	// Text outside of traces is left alone.
+	for _, line := range []string{
+		"panic: runtime error: invalid memory address or nil pointer dereference\n",
+		"exit status 2\n",
+	} {
+		if !strings.Contains(got, "\n"+line) {
+			t.Errorf("expected %q to be left uncolored", line)
+		}
+	}
+	if msg := "no goroutine here\n"; highlightStacks(msg) != msg {
+		t.Error("a message without a trace was changed")
+	}
+}
+
+func TestHighlightStacksFixture(t *testing.T) {
+	out := runMain(t, readFixture(t, "panic.log"), "-highlight-stacks", "-color", "always")
+	checkGolden(t, "panic.golden", out)
+}
+
+func TestColorizeKV(t *testing.T) {
+	keyColor := color.Color(1, 2, 3)
+	getColor := func(string) *color.Message { return keyColor }
+	k := keyColor.Sprint
+	for _, c := range []struct {
+		msg, exp string
+	}{
+		{"no pairs here", "no pairs here"},
+		{"a=1 b=two", k("a") + "=1 " + k("b") + "=two"},
+		{" user.id=7\n", " " + k("user.id") + "=7\n"},
+		{`msg="hello world" n=1`, k("msg") + `="hello world" ` + k("n") + "=1"},
+		{`err="bad \"quote\" here" n=1`, k("err") + `="bad \"quote\" here" ` + k("n") + "=1"},
+		{`path="C:\\dir\\" n=1`, k("path") + `="C:\\dir\\" ` + k("n") + "=1"},
+		{"empty= n=1", k("empty") + "= " + k("n") + "=1"},
+		// An unterminated quote ends at the next space like an unquoted value.
+		{`msg="open n=1`, k("msg") + `="open ` + k("n") + "=1"},
+		// Pairs must begin a word, and keys begin with a letter or underscore.
+		{"a==b x-y=1 9x=1 url=http://h/?q=1", k("a") + "==b " + k("x-y") + "=1 9x=1 " + k("url") + "=http://h/?q=1"},
+	} {
+		if got := colorizeKV(getColor, false)(c.msg); got != c.exp {
+			t.Errorf("colorizeKV(%q) = %q, expected %q", c.msg, got, c.exp)
+		}
+	}
+}
+
+func TestColorizeKVValueTypes(t *testing.T) {
+	keyColor := color.Color(1, 2, 3)
+	k := keyColor.Sprint
+	got := colorizeKV(func(string) *color.Message { return keyColor }, true)(
+		`n=1.5e3 ok=true v=null s="a b" e="x \"y\"" w=word empty=`)
+	exp := k("n") + "=" + kvNumberColor.Sprint("1.5e3") + " " +
+		k("ok") + "=" + kvBoolColor.Sprint("true") + " " +
+		k("v") + "=" + kvBoolColor.Sprint("null") + " " +
+		k("s") + "=" + kvStringColor.Sprint(`"a b"`) + " " +
+		k("e") + "=" + kvStringColor.Sprint(`"x \"y\""`) + " " +
+		k("w") + "=word " +
+		k("empty") + "="
+	if got != exp {
+		t.Errorf("got %q, expected %q", got, exp)
+	}
+}
+
+func TestColorizeKVFixture(t *testing.T) {
+	in := readFixture(t, "logfmt.log")
+	for _, c := range []struct {
+		golden string
+		args   []string
+	}{
+		{"logfmt.golden", nil},
+		{"logfmt-value-types.golden", []string{"-kv-value-types"}},
+	} {
+		t.Run(c.golden, func(t *testing.T) {
+			args := append([]string{"-colorize-kv", "-color", "always"}, c.args...)
+			out := runMain(t, in, args...)
+			if stripped := stripEscapes(out); stripped != in {
+				t.Fatalf("coloring changed the text of the output:\n%s", stripped)
+			}
+			checkGolden(t, c.golden, out)
+		})
+	}
+}
@@ -0,0 +1,54 @@
+// Copyright 2018 Andrew Werner, All Rights Reserved.
+
+package main
+
+import (
+	"encoding/csv"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// entryWriter writes entries in a structured output format rather than with
+// the output template.
+type entryWriter interface {
+	write(le *LogEntry) error
+	flush() error
+}
+
+// csvWriter writes entries as CSV rows with a column for each named capture
+// group of the pattern, in the order of the groups, followed by the message.
+type csvWriter struct {
+	w       *csv.Writer
+	columns []string
+	row     []string
+}
+
+func newCSVWriter(w io.Writer, pattern *regexp.Regexp) (*csvWriter, error) {
+	cw := &csvWriter{w: csv.NewWriter(w)}
+	seen := map[string]bool{}
+	for _, n := range pattern.SubexpNames() {
+		if n != "" && !seen[n] {
+			seen[n] = true
+			cw.columns = append(cw.columns, n)
+		}
+	}
+	cw.row = make([]string, len(cw.columns)+1)
+	return cw, cw.w.Write(append(cw.columns, "message"))
+}
+
+func (cw *csvWriter) write(le *LogEntry) error {
+	for i, c := range cw.columns {
+		cw.row[i] = ""
+		if le.Header != "" {
+			cw.row[i], _ = le.Match(c)
+		}
+	}
+	cw.row[len(cw.columns)] = strings.TrimRight(le.Message, "\r\n")
+	return cw.w.Write(cw.row)
+}
+
+func (cw *csvWriter) flush() error {
+	cw.w.Flush()
+	return cw.w.Error()
+}
@@ -0,0 +1,57 @@
+// Copyright 2018 Andrew Werner, All Rights Reserved.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+)
+
+// patternStats counts the entries matched by the header pattern and the lines
+// of input which matched no pattern. There is a single header pattern, but the
+// report lists patterns so that its format can hold several.
+type patternStats struct {
+	pattern        string
+	entries        int
+	unmatchedLines int
+}
+
+func newPatternStats(pattern string) *patternStats {
+	return &patternStats{pattern: pattern}
+}
+
+// add records a decoded entry. Entries without a header are unmatched text.
+func (s *patternStats) add(e *Entry) {
+	if e.Header != "" {
+		s.entries++
+		return
+	}
+	s.unmatchedLines += strings.Count(strings.TrimSuffix(e.Message, "\n"), "\n") + 1
+}
+
+type patternCount struct {
+	Pattern string `json:"pattern"`
+	Entries int    `json:"entries"`
+}
+
+// report writes the counts to w as a table or, if format is json, as a JSON
+// object.
+func (s *patternStats) report(w io.Writer, format string) error {
+	counts := []patternCount{{s.pattern, s.entries}}
+	if format == "json" {
+		return json.NewEncoder(w).Encode(struct {
+			Patterns       []patternCount `json:"patterns"`
+			UnmatchedLines int            `json:"unmatched_lines"`
+		}{counts, s.unmatchedLines})
+	}
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "pattern\tentries\n")
+	for _, c := range counts {
+		fmt.Fprintf(tw, "%s\t%d\n", c.Pattern, c.Entries)
+	}
+	fmt.Fprintf(tw, "(unmatched lines)\t%d\n", s.unmatchedLines)
+	return tw.Flush()
+}
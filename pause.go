@@ -0,0 +1,132 @@
+// Copyright 2018 Andrew Werner, All Rights Reserved.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+)
+
+// restoreTerminal undoes changes made to the mode of the controlling terminal.
+// It is called before the process exits.
+var restoreTerminal = func() {}
+
+// pauser is a writer which passes output through to w until it is paused,
+// after which output is held until it is resumed. At most limit bytes are
+// held; beyond that the oldest lines are dropped.
+type pauser struct {
+	w     io.Writer
+	limit int
+
+	mu      sync.Mutex
+	paused  bool
+	held    []byte
+	dropped int
+}
+
+func (p *pauser) Write(b []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.paused {
+		return p.w.Write(b)
+	}
+	p.held = append(p.held, b...)
+	if excess := len(p.held) - p.limit; excess > 0 {
+		if p.dropped == 0 {
+			fmt.Fprintf(os.Stderr, "logcolor: pause buffer of %d bytes is full, dropping the oldest output\n", p.limit)
+		}
+		if i := bytes.IndexByte(p.held[excess:], '\n'); i >= 0 {
+			excess += i + 1
+		}
+		p.held = p.held[:copy(p.held, p.held[excess:])]
+		p.dropped += excess
+	}
+	return len(b), nil
+}
+
+// toggle pauses output or, if it is paused, writes the held output and
+// resumes.
+func (p *pauser) toggle() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.paused {
+		p.paused = true
+		fmt.Fprintln(os.Stderr, "logcolor: paused, press any key to resume")
+		return nil
+	}
+	p.paused = false
+	if p.dropped > 0 {
+		fmt.Fprintf(os.Stderr, "logcolor: dropped %d bytes while paused\n", p.dropped)
+	}
+	_, err := p.w.Write(p.held)
+	p.held, p.dropped = p.held[:0], 0
+	return err
+}
+
+// release writes any held output and stops holding it.
+func (p *pauser) release() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.paused {
+		return nil
+	}
+	p.paused = false
+	_, err := p.w.Write(p.held)
+	p.held = nil
+	return err
+}
+
+// pauseOnKeypress reads keys from the controlling terminal, pausing p when
+// space is pressed and resuming it on the next key. The terminal is put into
+// cbreak mode so that keys are read as they are pressed; interrupts still
+// generate signals.
+func pauseOnKeypress(p *pauser) error {
+	tty, err := os.Open("/dev/tty")
+	if err != nil {
+		return err
+	}
+	saved, err := stty(tty, "-g")
+	if err != nil {
+		tty.Close()
+		return err
+	}
+	if _, err := stty(tty, "cbreak", "-echo"); err != nil {
+		tty.Close()
+		return err
+	}
+	restoreTerminal = func() { stty(tty, strings.TrimSpace(saved)) }
+	go func() {
+		key := make([]byte, 1)
+		for {
+			if _, err := tty.Read(key); err != nil {
+				return
+			}
+			p.mu.Lock()
+			paused := p.paused
+			p.mu.Unlock()
+			if key[0] != ' ' && !paused {
+				continue
+			}
+			if err := p.toggle(); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+			}
+		}
+	}()
+	return nil
+}
+
+// stty runs stty with the given arguments on the terminal tty.
+func stty(tty *os.File, args ...string) (string, error) {
+	cmd := exec.Command("stty", args...)
+	cmd.Stdin = tty
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("stty %v: %v", strings.Join(args, " "), err)
+	}
+	return string(out), nil
+}
@@ -0,0 +1,156 @@
+// Copyright 2018 Andrew Werner, All Rights Reserved.
+
+package main
+
+import (
+	"sort"
+	"strings"
+)
+
+// preset is the header pattern and output template for a known log format.
+// Presets of formats read by a LineDecoder give their input format in place
+// of a pattern, and may give the field which holds their severity, how it is
+// parsed, and the field by which entries are colored.
+type preset struct {
+	pattern       string
+	template      string
+	inputFormat   string
+	severityGroup string
+	levelOf       func(string) level
+	colorField    string
+}
+
+var presets = map[string]preset{
+	// glog is the format written by glog and cockroachdb, prefixed with the
+	// name of the node as is done when merging the logs of several nodes.
+	"glog": {
+		pattern: `(?m)^(?P<prefix>^[\w_\-.]+> )(?P<header>(?P<severity>[IWEF])(?P<time>\d{6} \d{2}:\d{2}:\d{2}.\d{6}) (?:(\d+) )?([^:]+):(\d+))`,
+		template: `
+{{- with $p := .Match "prefix" -}}
+{{- with $c := $.Color -}}
+{{ with $.ColorName }}{{ $c.Sprint . }} {{ end -}}
+{{ $.Match "header" | printf "%s%s" $p | $c.Sprint  }}
+{{- end -}}
+{{- end -}}
+{{- .Message -}}`,
+	},
+	// access-log matches the default access log formats of Envoy and the
+	// nginx combined format. The status is colored by its class and the rest
+	// of the line by the upstream host, which nginx does not log.
+	"access-log": {
+		pattern: `(?m)^(?:` +
+			`\[(?P<time>[^\]]+)\] "(?P<method>[A-Z]+) (?P<path>\S+) (?P<protocol>[^"]+)" (?P<status>\d{3}) (?P<flags>\S+) (?P<bytes_received>\d+) (?P<bytes_sent>\d+) (?P<latency>\d+) (?P<upstream_latency>\S+) "(?P<forwarded_for>[^"]*)" "(?P<user_agent>[^"]*)" "(?P<request_id>[^"]*)" "(?P<authority>[^"]*)" "(?P<upstream>[^"]*)"` +
+			`|` +
+			`(?P<remote_addr>\S+) \S+ (?P<remote_user>\S+) \[(?P<time>[^\]]+)\] "(?P<method>[A-Z]+) (?P<path>\S+) (?P<protocol>[^"]+)" (?P<status>\d{3}) (?P<bytes_sent>\d+) "(?P<referer>[^"]*)" "(?P<user_agent>[^"]*)"` +
+			`)`,
+		template: `
+{{- $c := color (.Match "upstream") -}}
+{{ .Match "time" | $c.Sprint }} {{ with $s := .Match "status" }}{{ (statuscolor $s).Sprint $s }}{{ end }} {{ .Match "method" }} {{ .Match "path" }}
+{{- with .Match "latency" }} {{ . }}ms{{ end }}
+{{- with .Match "upstream" }} {{ $c.Sprint . }}{{ end }}
+{{- .Message -}}`,
+	},
+	// rust matches the default formats of env_logger, [time LEVEL target], and
+	// of tracing-subscriber, time LEVEL target:, in which the time is
+	// optional. Entries are colored by their target.
+	"rust": {
+		pattern: `(?m)^(?:` +
+			`\[(?:(?P<time>\S+) +)?(?P<severity>TRACE|DEBUG|INFO|WARN|ERROR) +(?P<target>[^\]\s]+)\]` +
+			`|` +
+			`(?:(?P<time>\d{4}-\d\d-\d\dT\S+) +)?(?P<severity>TRACE|DEBUG|INFO|WARN|ERROR) +(?P<target>[\w:]*\w):` +
+			`)`,
+		template: `
+{{- $c := color (.Match "target") -}}
+{{ with .Match "time" }}{{ $c.Sprint . }} {{ end -}}
+{{ .Match "severity" | levelchip }} {{ .Match "target" | $c.Sprint }}
+{{- .Message -}}`,
+	},
+	// lambda matches the lines AWS Lambda writes to CloudWatch Logs: those of
+	// the runtime's logger, time request-id LEVEL separated by tabs, the
+	// INIT_START line of a cold start and the START, END and REPORT lines which
+	// surround each invocation. Entries are colored by their request id so that
+	// the lines of an invocation share a color, and the duration and memory used
+	// of REPORT lines are in bold.
+	"lambda": {
+		pattern: `(?m)^(?:` +
+			`(?P<time>\d{4}-\d\d-\d\dT\d\d:\d\d:\d\d(?:\.\d+)?Z)\t(?P<prefix>(?P<request_id>[0-9a-f-]{36}))\t(?P<severity>TRACE|DEBUG|INFO|WARN|ERROR|FATAL)\t` +
+			`|` +
+			`(?P<event>INIT_START)` +
+			`|` +
+			`(?P<event>START|END) RequestId: (?P<prefix>(?P<request_id>[0-9a-f-]{36}))` +
+			`|` +
+			`(?P<event>REPORT) RequestId: (?P<prefix>(?P<request_id>[0-9a-f-]{36}))\tDuration: (?P<duration>[\d.]+) ms\tBilled Duration: (?P<billed_duration>\d+) ms\tMemory Size: (?P<memory_size>\d+) MB\tMax Memory Used: (?P<max_memory>\d+) MB(?:\tInit Duration: (?P<init_duration>[\d.]+) ms)?` +
+			`)`,
+		template: `
+{{- $c := .Color -}}
+{{- with .Match "event" -}}
+{{ bold . }}{{ with $.Match "request_id" }} {{ $c.Sprint . }}{{ end }}
+{{- with $.Match "duration" }} duration {{ bold . }} ms billed {{ $.Match "billed_duration" }} ms memory {{ bold ($.Match "max_memory") }}/{{ $.Match "memory_size" }} MB{{ end -}}
+{{- with $.Match "init_duration" }} init {{ . }} ms{{ end -}}
+{{- else -}}
+{{ .Match "time" | $c.Sprint }} {{ .Match "request_id" | $c.Sprint }} {{ .Match "severity" | levelchip | printf "%s " }}
+{{- end -}}
+{{- .Message -}}`,
+	},
+	// syslog matches the formats of RFC 5424 and of the BSD syslog of RFC
+	// 3164. Entries are colored by their hostname and app-name, or tag.
+	"syslog": {
+		pattern: `(?m)^(?:` +
+			`<(?P<pri>\d{1,3})>1 (?P<time>\S+) (?P<prefix>(?P<host>\S+) (?P<app>\S+)) (?P<procid>\S+) (?P<msgid>\S+) (?:-|(?:\[(?:[^\]"]|"(?:[^"\\]|\\.)*")*\])+)` +
+			`|` +
+			`<(?P<pri>\d{1,3})>(?P<time>[A-Z][a-z]{2} [ \d]\d \d\d:\d\d:\d\d) (?P<prefix>(?P<host>\S+) (?P<app>[^:\[\s]+))(?:\[(?P<procid>\d+)\])?:` +
+			`)`,
+		template: `
+{{- $c := .Color -}}
+{{ .Match "time" | $c.Sprint }} {{ .Match "prefix" | $c.Sprint }}
+{{- with .Match "procid" }}{{ if ne . "-" }}[{{ . }}]{{ end }}{{ end -}}
+{{- .Message -}}`,
+	},
+	// otel is the JSON encoding of OpenTelemetry log records, which are colored
+	// by the trace to which they belong.
+	"otel": {
+		inputFormat:   "json",
+		severityGroup: "SeverityNumber",
+		levelOf:       parseSeverityNumber,
+		colorField:    "TraceId",
+		template: `
+{{- with .Field "Timestamp" }}{{ . }} {{ end -}}
+{{- with .Field "SeverityText" }}{{ levelchip . }} {{ end -}}
+{{- with $k := .ColorKey }}{{ with $.Color }}{{ printf "%.8s" $k | .Sprint }} {{ end }}{{ end -}}
+{{- .Field "Body" -}}
+{{- with .Field "Attributes" }} {{ . }}{{ end -}}
+{{- .Message -}}`,
+	},
+	// serilog is the JSON written by Serilog's JsonFormatter, which is colored
+	// by the message template of each event so that events of the same kind
+	// share a color however their property values vary.
+	"serilog": {
+		inputFormat:   "json",
+		severityGroup: "Level",
+		colorField:    "MessageTemplate",
+		template: `
+{{- with .Field "Timestamp" }}{{ . }} {{ end -}}
+{{- with .Field "Level" }}{{ levelchip . }} {{ end -}}
+{{- $.FillTemplate "MessageTemplate" | $.Color.Sprint -}}
+{{- with .Field "Exception" }} {{ . }}{{ end -}}
+{{- .Message -}}`,
+	},
+}
+
+// fieldsTemplate is the output template of the json and logfmt input formats.
+// It writes the time, level and message fields common to structured loggers,
+// or the whole line if it has no message field.
+const fieldsTemplate = `
+{{- with or (.Field "time") (.Field "ts") }}{{ . }} {{ end -}}
+{{- with .Field "level" }}{{ levelchip . }} {{ end -}}
+{{- with .Field "msg" }}{{ . }}{{ else }}{{ with .Field "message" }}{{ . }}{{ else }}{{ $.Header }}{{ end }}{{ end -}}
+{{- .Message -}}`
+
+func presetNames() string {
+	names := make([]string, 0, len(presets))
+	for n := range presets {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
@@ -0,0 +1,98 @@
+// Copyright 2018 Andrew Werner, All Rights Reserved.
+
+package main
+
+import "testing"
+
+func TestOTelPreset(t *testing.T) {
+	in := readFixture(t, "otel.jsonl")
+	for _, c := range []struct {
+		golden string
+		args   []string
+	}{
+		{"otel.golden", nil},
+		{"otel-min-level.golden", []string{"-min-level", "warn"}},
+		{"otel-color-by-attribute.golden", []string{"-color-by-field", "Resource.service.name"}},
+	} {
+		t.Run(c.golden, func(t *testing.T) {
+			args := append([]string{"-preset", "otel", "-color", "always"}, c.args...)
+			checkGolden(t, c.golden, runMain(t, in, args...))
+		})
+	}
+}
+
+func TestParseSeverityNumber(t *testing.T) {
+	for s, exp := range map[string]level{
+		"1":  traceLevel,
+		"4":  traceLevel,
+		"5":  debugLevel,
+		"9":  infoLevel,
+		"13": warningLevel,
+		"17": errorLevel,
+		"24": fatalLevel,
+		"0":  unknownLevel,
+		"25": unknownLevel,
+		"":   unknownLevel,
+	} {
+		if got := parseSeverityNumber(s); got != exp {
+			t.Errorf("parseSeverityNumber(%q) = %v, expected %v", s, got, exp)
+		}
+	}
+}
+
+func TestSerilogPreset(t *testing.T) {
+	out := runMain(t, readFixture(t, "serilog.jsonl"), "-preset", "serilog", "-color", "always")
+	checkGolden(t, "serilog.golden", out)
+}
+
+func TestAccessLogPreset(t *testing.T) {
+	for _, c := range []struct {
+		fixture string
+		golden  string
+		args    []string
+	}{
+		{"envoy.log", "envoy.golden", nil},
+		{"envoy.log", "envoy-min-status.golden", []string{"-min-status", "400"}},
+		{"nginx.log", "nginx.golden", nil},
+		{"nginx.log", "nginx-min-status.golden", []string{"-min-status", "400"}},
+	} {
+		t.Run(c.golden, func(t *testing.T) {
+			args := append([]string{"-preset", "access-log", "-color", "always"}, c.args...)
+			checkGolden(t, c.golden, runMain(t, readFixture(t, c.fixture), args...))
+		})
+	}
+}
+
+func TestRustPreset(t *testing.T) {
+	for _, c := range []struct {
+		fixture string
+		golden  string
+		args    []string
+	}{
+		{"env_logger.log", "env_logger.golden", nil},
+		{"env_logger.log", "env_logger-min-level.golden", []string{"-min-level", "warn"}},
+		{"tracing.log", "tracing.golden", nil},
+		{"tracing.log", "tracing-min-level.golden", []string{"-min-level", "warn"}},
+	} {
+		t.Run(c.golden, func(t *testing.T) {
+			args := append([]string{"-preset", "rust", "-color", "always"}, c.args...)
+			checkGolden(t, c.golden, runMain(t, readFixture(t, c.fixture), args...))
+		})
+	}
+}
+
+func TestLambdaPreset(t *testing.T) {
+	in := readFixture(t, "lambda.log")
+	for _, c := range []struct {
+		golden string
+		args   []string
+	}{
+		{"lambda.golden", nil},
+		{"lambda-min-level.golden", []string{"-min-level", "error"}},
+	} {
+		t.Run(c.golden, func(t *testing.T) {
+			args := append([]string{"-preset", "lambda", "-color", "always"}, c.args...)
+			checkGolden(t, c.golden, runMain(t, in, args...))
+		})
+	}
+}
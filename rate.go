@@ -0,0 +1,125 @@
+// Copyright 2018 Andrew Werner, All Rights Reserved.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// rateWriter is a writer which writes lines to w no faster than one per
+// interval for -max-rate. Lines which cannot yet be written are queued, and
+// when more than limit are queued the oldest are dropped and a line noting the
+// number dropped is written in their place.
+type rateWriter struct {
+	w        io.Writer
+	interval time.Duration
+	limit    int
+
+	mu      sync.Mutex
+	lines   [][]byte
+	partial []byte
+	dropped int
+	closed  bool
+	err     error
+	wake    chan struct{}
+	done    chan struct{}
+}
+
+func newRateWriter(w io.Writer, perSecond, limit int) *rateWriter {
+	rw := &rateWriter{
+		w:        w,
+		interval: time.Second / time.Duration(perSecond),
+		limit:    limit,
+		wake:     make(chan struct{}, 1),
+		done:     make(chan struct{}),
+	}
+	go rw.run()
+	return rw
+}
+
+func (rw *rateWriter) Write(b []byte) (int, error) {
+	rw.mu.Lock()
+	defer rw.mu.Unlock()
+	if rw.err != nil {
+		return 0, rw.err
+	}
+	n := len(b)
+	for len(b) > 0 {
+		i := bytes.IndexByte(b, '\n')
+		if i < 0 {
+			rw.partial = append(rw.partial, b...)
+			break
+		}
+		rw.lines = append(rw.lines, append(rw.partial, b[:i+1]...))
+		rw.partial, b = nil, b[i+1:]
+	}
+	if excess := len(rw.lines) - rw.limit; excess > 0 {
+		rw.lines = rw.lines[excess:]
+		rw.dropped += excess
+	}
+	rw.signal()
+	return n, nil
+}
+
+func (rw *rateWriter) signal() {
+	select {
+	case rw.wake <- struct{}{}:
+	default:
+	}
+}
+
+// close writes any queued lines without waiting between them and returns the
+// first error encountered writing to w.
+func (rw *rateWriter) close() error {
+	rw.mu.Lock()
+	if len(rw.partial) > 0 {
+		rw.lines = append(rw.lines, rw.partial)
+		rw.partial = nil
+	}
+	rw.closed = true
+	rw.signal()
+	rw.mu.Unlock()
+	<-rw.done
+	return rw.err
+}
+
+// run writes queued lines to w, waiting for the interval to pass between them.
+func (rw *rateWriter) run() {
+	defer close(rw.done)
+	var last time.Time
+	for {
+		rw.mu.Lock()
+		var line []byte
+		switch {
+		case rw.dropped > 0:
+			line = []byte(dim(fmt.Sprintf("logcolor: dropped %d lines", rw.dropped)) + "\n")
+			rw.dropped = 0
+		case len(rw.lines) > 0:
+			line = rw.lines[0]
+			rw.lines = rw.lines[1:]
+		case rw.closed:
+			rw.mu.Unlock()
+			return
+		}
+		closed := rw.closed
+		rw.mu.Unlock()
+		if line == nil {
+			<-rw.wake
+			continue
+		}
+		if wait := rw.interval - time.Since(last); wait > 0 && !closed {
+			time.Sleep(wait)
+		}
+		last = time.Now()
+		if _, err := rw.w.Write(line); err != nil {
+			rw.mu.Lock()
+			rw.err = err
+			rw.mu.Unlock()
+			return
+		}
+	}
+}
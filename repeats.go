@@ -0,0 +1,64 @@
+// Copyright 2018 Andrew Werner, All Rights Reserved.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+)
+
+// repeatCompactor writes rendered entries to a terminal, collapsing runs of a
+// repeated single line entry into its latest occurrence followed by a count of
+// the repetitions, which is rewritten in place as the run grows.
+type repeatCompactor struct {
+	w io.Writer
+	// open is true if the last line written is not yet terminated.
+	open  bool
+	key   string
+	count int
+}
+
+// clearToEOL erases the rest of the line, which may hold the end of a longer
+// line which was rewritten.
+const clearToEOL = "\x1b[K"
+
+func newRepeatCompactor(w io.Writer) *repeatCompactor {
+	return &repeatCompactor{w: w}
+}
+
+// write writes the rendered entry. Entries with the same key repeat one
+// another.
+func (c *repeatCompactor) write(key string, rendered []byte) error {
+	line := bytes.TrimSuffix(rendered, []byte("\n"))
+	if bytes.IndexByte(line, '\n') >= 0 {
+		// Multi-line entries cannot be rewritten in place.
+		if err := c.end(); err != nil {
+			return err
+		}
+		_, err := c.w.Write(rendered)
+		return err
+	}
+	if c.open && key == c.key {
+		c.count++
+		_, err := fmt.Fprintf(c.w, "\r%s (x%d)%s", line, c.count, clearToEOL)
+		return err
+	}
+	if err := c.end(); err != nil {
+		return err
+	}
+	c.open, c.key, c.count = true, key, 1
+	_, err := c.w.Write(line)
+	return err
+}
+
+// end terminates the current line, which is left open so that it can be
+// rewritten if it repeats.
+func (c *repeatCompactor) end() error {
+	if !c.open {
+		return nil
+	}
+	c.open = false
+	_, err := io.WriteString(c.w, "\n")
+	return err
+}
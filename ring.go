@@ -0,0 +1,71 @@
+// Copyright 2018 Andrew Werner, All Rights Reserved.
+
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"sort"
+)
+
+// colorRing assigns keys to a fixed set of colors by consistent hashing. Each
+// color is placed at several points on a ring of hashes and a key is given the
+// color of the first point at or after its hash. Unlike assigning colors by
+// the hash modulo the number of colors, changing the number of colors only
+// recolors the keys whose nearest point changed, as the hue of each color
+// depends only on its index.
+type colorRing struct {
+	points []ringPoint
+	size   int
+}
+
+type ringPoint struct {
+	hash  uint64
+	color int
+}
+
+// ringReplicas is the number of points on the ring for each color, which
+// evens out the share of keys given each color.
+const ringReplicas = 64
+
+func newColorRing(size int) *colorRing {
+	r := &colorRing{size: size}
+	for i := 0; i < size; i++ {
+		for j := 0; j < ringReplicas; j++ {
+			r.points = append(r.points, ringPoint{
+				hash:  ringHash(fmt.Sprintf("color-%d-%d", i, j)),
+				color: i,
+			})
+		}
+	}
+	sort.Slice(r.points, func(i, j int) bool { return r.points[i].hash < r.points[j].hash })
+	return r
+}
+
+func ringHash(s string) uint64 {
+	sum := keyHash(s)
+	return binary.BigEndian.Uint64(sum[:8])
+}
+
+// goldenAngle is the angle in degrees by which the hues of successive colors
+// of the ring are separated.
+const goldenAngle = 137.50776405003785
+
+// color returns the index of the color of the key s.
+func (r *colorRing) color(s string) int {
+	hash := ringHash(s)
+	i := sort.Search(len(r.points), func(i int) bool { return r.points[i].hash >= hash })
+	if i == len(r.points) {
+		i = 0
+	}
+	return r.points[i].color
+}
+
+// hue returns the hue of the color of the key s. Each color's hue is a
+// multiple of the golden angle, which depends on its index alone, so that
+// colors keep their hues when the size of the ring changes while any number of
+// them are spread evenly around the color wheel.
+func (r *colorRing) hue(s string) float64 {
+	return math.Mod(float64(r.color(s))*goldenAngle, 360)
+}
@@ -0,0 +1,50 @@
+// Copyright 2018 Andrew Werner, All Rights Reserved.
+
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+// TestColorRingResize checks that growing the ring only recolors the keys
+// given the new color, and that those which keep their color index keep their
+// hue.
+func TestColorRingResize(t *testing.T) {
+	small, large := newColorRing(8), newColorRing(9)
+	const n = 10000
+	moved := 0
+	for i := 0; i < n; i++ {
+		k := fmt.Sprintf("key-%d", i)
+		a, b := small.color(k), large.color(k)
+		if a != b {
+			moved++
+			if b != 8 {
+				t.Fatalf("%v moved from color %d to %d rather than to the new color", k, a, b)
+			}
+			continue
+		}
+		if small.hue(k) != large.hue(k) {
+			t.Fatalf("%v kept color %d but its hue changed from %v to %v", k, a, small.hue(k), large.hue(k))
+		}
+	}
+	// About one key in nine should be given the new color.
+	if moved < n/18 || moved > n/6 {
+		t.Errorf("%d of %d keys were recolored, expected about %d", moved, n, n/9)
+	}
+}
+
+func TestColorRingHues(t *testing.T) {
+	r := newColorRing(12)
+	seen := map[float64]bool{}
+	for i := 0; len(seen) < r.size && i < 10000; i++ {
+		h := r.hue(fmt.Sprintf("key-%d", i))
+		if h < 0 || h >= 360 {
+			t.Fatalf("hue %v out of range", h)
+		}
+		seen[h] = true
+	}
+	if len(seen) != r.size {
+		t.Errorf("found %d distinct hues, expected %d", len(seen), r.size)
+	}
+}
@@ -0,0 +1,79 @@
+// Copyright 2018 Andrew Werner, All Rights Reserved.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strconv"
+	"unicode/utf8"
+
+	"github.com/lucasb-eyer/go-colorful"
+)
+
+// rowLuminance is the luminance of full row backgrounds, which is low enough
+// that the colors of the text drawn over them remain legible.
+const rowLuminance = .2
+
+// rowBackground returns the background color for rows of the key s.
+func (m *colorMap) rowBackground(s string) colorful.Color {
+	h, _, _ := m.keyHCL(s)
+	return colorful.Hcl(h, .15, rowLuminance).Clamped()
+}
+
+// levelRowBackground returns a background color for rows of a level with the
+// hue of the level's chip color.
+func levelRowBackground(chip colorful.Color) colorful.Color {
+	h, c, _ := chip.Hcl()
+	return colorful.Hcl(h, c/2, rowLuminance).Clamped()
+}
+
+// terminalWidth returns the width of the terminal from the COLUMNS environment
+// variable, or 80 if it is not set.
+func terminalWidth() int {
+	if w, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && w > 0 {
+		return w
+	}
+	return 80
+}
+
+// sgrResets are escape sequences which clear the background color and after
+// which it must be set again.
+var sgrResets = [][]byte{[]byte("\x1b[0m"), []byte("\x1b[m"), []byte("\x1b[49m"), []byte("\x1b[39;49m")}
+
+// fullRow sets the background of each line of rendered to bg, padding the
+// lines with spaces to width columns.
+func fullRow(rendered []byte, bg colorful.Color, width int) []byte {
+	r, g, b := bg.RGB255()
+	set := []byte(fmt.Sprintf("\x1b[48;2;%d;%d;%dm", r, g, b))
+	var buf bytes.Buffer
+	for _, line := range bytes.SplitAfter(bytes.TrimSuffix(rendered, []byte("\n")), []byte("\n")) {
+		line = bytes.TrimSuffix(line, []byte("\n"))
+		buf.Write(set)
+		cols := 0
+		for i := 0; i < len(line); {
+			if line[i] == '\x1b' {
+				n := escapeLen(string(line[i:]))
+				buf.Write(line[i : i+n])
+				for _, reset := range sgrResets {
+					if bytes.Equal(line[i:i+n], reset) {
+						buf.Write(set)
+						break
+					}
+				}
+				i += n
+				continue
+			}
+			r, n := utf8.DecodeRune(line[i:])
+			buf.Write(line[i : i+n])
+			cols += runeWidth(r)
+			i += n
+		}
+		if cols < width {
+			buf.Write(bytes.Repeat([]byte(" "), width-cols))
+		}
+		buf.WriteString("\x1b[49m\n")
+	}
+	return buf.Bytes()
+}
@@ -0,0 +1,52 @@
+// Copyright 2018 Andrew Werner, All Rights Reserved.
+
+package main
+
+import (
+	"regexp"
+
+	"github.com/lucasb-eyer/go-colorful"
+	"github.com/wayneashleyberry/truecolor/pkg/color"
+)
+
+// sessionColors are cycled through by consecutive sessions so that adjacent
+// sessions are distinguishable.
+var sessionColors = func() []*color.Message {
+	const n = 6
+	colors := make([]*color.Message, n)
+	for i := range colors {
+		colors[i] = color.Color(colorful.Hcl(360*float64(i)/n+30, .45, .75).Clamped().RGB255())
+	}
+	return colors
+}()
+
+// sessions tracks the runs of entries between an entry matching a start
+// pattern and one matching an end pattern. Sessions do not nest: a start
+// within a session begins a new session. A session which is not ended lasts
+// until the next start or the end of the input.
+type sessions struct {
+	start, end *regexp.Regexp
+	n          int
+	active     bool
+}
+
+func newSessions(start, end *regexp.Regexp) *sessions {
+	return &sessions{start: start, end: end}
+}
+
+// next returns the color of the session which the entry with the given text
+// belongs to, or nil if it is not in a session. It must be called once for
+// each entry in order. The entries which start and end a session belong to it.
+func (s *sessions) next(text string) *color.Message {
+	if s.start.MatchString(text) {
+		s.active = true
+		s.n++
+	} else if !s.active {
+		return nil
+	}
+	col := sessionColors[(s.n-1)%len(sessionColors)]
+	if s.end != nil && s.end.MatchString(text) {
+		s.active = false
+	}
+	return col
+}
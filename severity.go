@@ -0,0 +1,52 @@
+// Copyright 2018 Andrew Werner, All Rights Reserved.
+
+package main
+
+import (
+	"strconv"
+	"strings"
+)
+
+// level is the severity of a log entry, ordered from least to most severe.
+type level int
+
+const (
+	unknownLevel level = iota
+	traceLevel
+	debugLevel
+	infoLevel
+	warningLevel
+	errorLevel
+	fatalLevel
+)
+
+// parseLevel parses a severity as written by common loggers, either as the
+// single letter used by glog or as a word like "warn" or "ERROR".
+func parseLevel(s string) level {
+	switch strings.ToUpper(s) {
+	case "T", "TRACE", "VERBOSE":
+		return traceLevel
+	case "D", "DEBUG":
+		return debugLevel
+	case "I", "INFO", "INFORMATION":
+		return infoLevel
+	case "W", "WARN", "WARNING":
+		return warningLevel
+	case "E", "ERR", "ERROR":
+		return errorLevel
+	case "F", "FATAL", "CRIT", "CRITICAL", "PANIC":
+		return fatalLevel
+	default:
+		return unknownLevel
+	}
+}
+
+// parseSeverityNumber parses an OpenTelemetry SeverityNumber, which ranges
+// from 1 to 24 in bands of four for each level from trace to fatal.
+func parseSeverityNumber(s string) level {
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 1 || n > 24 {
+		return unknownLevel
+	}
+	return traceLevel + level((n-1)/4)
+}
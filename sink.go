@@ -0,0 +1,108 @@
+// Copyright 2018 Andrew Werner, All Rights Reserved.
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// Sink is an additional destination for the entries which pass its filter.
+type Sink struct {
+	path     string
+	f        *os.File
+	w        *bufio.Writer
+	minLevel level
+	grep     *regexp.Regexp
+}
+
+// parseSink parses a sink specification of the form
+//
+//	file=PATH[,level=LEVEL][,grep=REGEXP]
+//
+// The grep option must be last as its regular expression may contain commas.
+func parseSink(spec string) (*Sink, error) {
+	s := &Sink{}
+	for rest := spec; rest != ""; {
+		var kv string
+		if strings.HasPrefix(rest, "grep=") {
+			kv, rest = rest, ""
+		} else if i := strings.IndexByte(rest, ','); i >= 0 {
+			kv, rest = rest[:i], rest[i+1:]
+		} else {
+			kv, rest = rest, ""
+		}
+		i := strings.IndexByte(kv, '=')
+		if i < 0 {
+			return nil, fmt.Errorf("invalid sink %q: expected key=value, got %q", spec, kv)
+		}
+		switch k, v := kv[:i], kv[i+1:]; k {
+		case "file":
+			s.path = v
+		case "level":
+			if s.minLevel = parseLevel(v); s.minLevel == unknownLevel {
+				return nil, fmt.Errorf("invalid sink %q: unknown level %q", spec, v)
+			}
+		case "grep":
+			re, err := regexp.Compile(v)
+			if err != nil {
+				return nil, fmt.Errorf("invalid sink %q: %v", spec, err)
+			}
+			s.grep = re
+		default:
+			return nil, fmt.Errorf("invalid sink %q: unknown option %q", spec, k)
+		}
+	}
+	if s.path == "" {
+		return nil, fmt.Errorf("invalid sink %q: no file", spec)
+	}
+	return s, nil
+}
+
+func (s *Sink) open() error {
+	f, err := os.Create(s.path)
+	if err != nil {
+		return err
+	}
+	s.f, s.w = f, bufio.NewWriter(f)
+	return nil
+}
+
+// accepts returns true if the entry passes the sink's filter. Entries of an
+// unknown level pass the level filter.
+func (s *Sink) accepts(le *LogEntry) bool {
+	if l := le.level(); s.minLevel != unknownLevel && l != unknownLevel && l < s.minLevel {
+		return false
+	}
+	return s.grep == nil || s.grep.MatchString(le.Header+le.Message)
+}
+
+func (s *Sink) close() error {
+	if err := s.w.Flush(); err != nil {
+		return err
+	}
+	return s.f.Close()
+}
+
+// sinkFlag is a flag.Value which accumulates a Sink for each use of the flag.
+type sinkFlag []*Sink
+
+func (f *sinkFlag) String() string {
+	paths := make([]string, len(*f))
+	for i, s := range *f {
+		paths[i] = s.path
+	}
+	return strings.Join(paths, ",")
+}
+
+func (f *sinkFlag) Set(spec string) error {
+	s, err := parseSink(spec)
+	if err != nil {
+		return err
+	}
+	*f = append(*f, s)
+	return nil
+}
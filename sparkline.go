@@ -0,0 +1,111 @@
+// Copyright 2018 Andrew Werner, All Rights Reserved.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/wayneashleyberry/truecolor/pkg/color"
+)
+
+// sparklines records when the entries of each color key were seen for
+// -sparkline. Entries are placed by their timestamps if every entry has one
+// which parses, and otherwise by the order in which they arrived.
+type sparklines struct {
+	keys     []string
+	times    map[string][]int64
+	arrivals map[string][]int64
+	n        int64
+	untimed  bool
+}
+
+func newSparklines() *sparklines {
+	return &sparklines{
+		times:    map[string][]int64{},
+		arrivals: map[string][]int64{},
+	}
+}
+
+// add records an entry with the given color key and timestamp.
+func (s *sparklines) add(colorKey, timestamp string) {
+	if _, ok := s.arrivals[colorKey]; !ok {
+		s.keys = append(s.keys, colorKey)
+	}
+	s.arrivals[colorKey] = append(s.arrivals[colorKey], s.n)
+	s.n++
+	if s.untimed {
+		return
+	}
+	t, ok := parseTimestamp(timestamp)
+	if !ok {
+		s.untimed, s.times = true, nil
+		return
+	}
+	s.times[colorKey] = append(s.times[colorKey], t.UnixNano())
+}
+
+// sparkBars are the bars of a sparkline in increasing height.
+var sparkBars = []rune("▁▂▃▄▅▆▇█")
+
+// sparklineWidth is the number of intervals into which the run is divided.
+const sparklineWidth = 40
+
+// report writes a sparkline of the number of entries of each key in each
+// interval of the run to w. Bars are scaled by the busiest interval of any
+// key so that the lines of different keys may be compared. Intervals in which
+// a key had no entries are left blank.
+func (s *sparklines) report(w io.Writer, getColor func(string) *color.Message) {
+	positions := s.times
+	if s.untimed {
+		positions = s.arrivals
+	}
+	first, last, ok := int64(0), int64(0), false
+	for _, ps := range positions {
+		for _, p := range ps {
+			if !ok || p < first {
+				first = p
+			}
+			if !ok || p > last {
+				last = p
+			}
+			ok = true
+		}
+	}
+	if !ok {
+		return
+	}
+	span := last - first + 1
+	counts := make(map[string][]int, len(s.keys))
+	max := 0
+	for _, k := range s.keys {
+		c := make([]int, sparklineWidth)
+		for _, p := range positions[k] {
+			i := int(float64(p-first) / float64(span) * sparklineWidth)
+			if c[i]++; c[i] > max {
+				max = c[i]
+			}
+		}
+		counts[k] = c
+	}
+	width := 0
+	for _, k := range s.keys {
+		if n := visibleWidth(strings.TrimSpace(k)); n > width {
+			width = n
+		}
+	}
+	for _, k := range s.keys {
+		var line strings.Builder
+		for _, c := range counts[k] {
+			if c == 0 {
+				line.WriteByte(' ')
+				continue
+			}
+			line.WriteRune(sparkBars[(c*len(sparkBars)-1)/max])
+		}
+		name := strings.TrimSpace(k)
+		fmt.Fprintf(w, "%s%s %s\n", name, strings.Repeat(" ", width-visibleWidth(name)),
+			getColor(k).Sprint(line.String()))
+	}
+}
@@ -0,0 +1,75 @@
+// Copyright 2018 Andrew Werner, All Rights Reserved.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	"github.com/wayneashleyberry/truecolor/pkg/color"
+)
+
+// summary aggregates entries by the signature of their message for -summary.
+type summary struct {
+	signatures []string
+	groups     map[string]*summaryGroup
+}
+
+type summaryGroup struct {
+	colorKey    string
+	message     string
+	count       int
+	first, last string
+}
+
+func newSummary() *summary {
+	return &summary{groups: map[string]*summaryGroup{}}
+}
+
+// add records an entry with the given color key, message and timestamp.
+func (s *summary) add(colorKey, message, timestamp string) {
+	sig := signature(message)
+	g, ok := s.groups[sig]
+	if !ok {
+		g = &summaryGroup{
+			colorKey: colorKey,
+			message:  strings.TrimSpace(firstLine(message)),
+			first:    timestamp,
+		}
+		s.groups[sig] = g
+		s.signatures = append(s.signatures, sig)
+	}
+	g.count++
+	g.last = timestamp
+}
+
+// report writes each distinct message in the order in which it was first seen
+// along with the number of times it was seen and the timestamps of its first
+// and last occurrences.
+func (s *summary) report(w io.Writer, getColor func(string) *color.Message) {
+	fmt.Fprintf(w, "logcolor: %d distinct errors\n", len(s.signatures))
+	for _, sig := range s.signatures {
+		g := s.groups[sig]
+		fmt.Fprintf(w, "%8d  %s - %s  %s\n", g.count, g.first, g.last,
+			getColor(g.colorKey).Sprint(g.message))
+	}
+}
+
+var signatureDigits = regexp.MustCompile(`\d+`)
+
+// signature normalizes the first line of a message such that messages which
+// differ only in the numbers they contain share a signature.
+func signature(message string) string {
+	s := signatureDigits.ReplaceAllLiteralString(firstLine(message), "#")
+	return strings.Join(strings.Fields(s), " ")
+}
+
+func firstLine(s string) string {
+	s = strings.TrimLeft(s, " \t\r\n")
+	if i := strings.IndexByte(s, '\n'); i >= 0 {
+		return s[:i]
+	}
+	return s
+}
@@ -0,0 +1,185 @@
+// Copyright 2018 Andrew Werner, All Rights Reserved.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"io"
+	"strings"
+)
+
+// The metrics of the font assumed by svgWriter: a monospace font of 14px
+// whose characters advance by 0.6em, as is the case for DejaVu Sans Mono,
+// Menlo and Consolas. Viewers which substitute a font with other metrics
+// will misplace backgrounds and clip long lines.
+const (
+	svgFontSize   = 14
+	svgCharWidth  = 8.4
+	svgLineHeight = 18
+	svgPadding    = 12
+)
+
+// svgMaxLines and svgMaxColumns bound the size of the image. Further lines are
+// replaced by a note of how many were left out and longer lines are clipped.
+const (
+	svgMaxLines   = 2000
+	svgMaxColumns = 240
+)
+
+// svgSpan is a run of text of a single style on a line of the image.
+type svgSpan struct {
+	style htmlStyle
+	col   int
+	text  string
+}
+
+// svgWriter is a writer which converts text colored with SGR escape sequences
+// into an SVG image for -output-format svg. As the size of the image must be
+// known before its content is written, lines are held until close.
+type svgWriter struct {
+	w     io.Writer
+	theme string
+	sgrScanner
+	lines   [][]svgSpan
+	line    []svgSpan
+	col     int
+	omitted int
+}
+
+func newSVGWriter(w io.Writer, theme string) *svgWriter {
+	return &svgWriter{w: w, theme: theme}
+}
+
+func (sw *svgWriter) Write(b []byte) (int, error) {
+	sw.scan(b, sw.text)
+	return len(b), nil
+}
+
+// text adds t in the current style to the lines of the image.
+func (sw *svgWriter) text(t []byte) {
+	for len(t) > 0 {
+		i := bytes.IndexByte(t, '\n')
+		run := t
+		if i >= 0 {
+			run = t[:i]
+		}
+		sw.add(strings.TrimRight(string(run), "\r"))
+		if i < 0 {
+			return
+		}
+		sw.endLine()
+		t = t[i+1:]
+	}
+}
+
+// add adds s to the current line, expanding tabs and clipping it at
+// svgMaxColumns.
+func (sw *svgWriter) add(s string) {
+	var buf strings.Builder
+	start := sw.col
+	for _, r := range s {
+		w := runeWidth(r)
+		if r == '\t' {
+			w = 8 - sw.col%8
+			r = ' '
+			buf.WriteString(strings.Repeat(" ", w-1))
+		}
+		if sw.col+w > svgMaxColumns {
+			break
+		}
+		buf.WriteRune(r)
+		sw.col += w
+	}
+	if buf.Len() > 0 {
+		sw.line = append(sw.line, svgSpan{style: sw.style, col: start, text: buf.String()})
+	}
+}
+
+func (sw *svgWriter) endLine() {
+	if len(sw.lines) < svgMaxLines {
+		sw.lines = append(sw.lines, sw.line)
+	} else {
+		sw.omitted++
+	}
+	sw.line, sw.col = nil, 0
+}
+
+// svgThemes are the background and text colors of the dark and light themes.
+var svgThemes = map[string][2]string{
+	"dark":  {"#1e1e1e", "#d4d4d4"},
+	"light": {"#ffffff", "#1e1e1e"},
+}
+
+// close writes the image.
+func (sw *svgWriter) close() error {
+	if len(sw.line) > 0 {
+		sw.endLine()
+	}
+	lines := sw.lines
+	if sw.omitted > 0 {
+		note := fmt.Sprintf("... %d more lines", sw.omitted)
+		lines = append(lines, []svgSpan{{text: note}})
+	}
+	cols := 0
+	for _, l := range lines {
+		if n := len(l); n > 0 {
+			if end := l[n-1].col + visibleWidth(l[n-1].text); end > cols {
+				cols = end
+			}
+		}
+	}
+	width := 2*svgPadding + float64(cols)*svgCharWidth
+	height := 2*svgPadding + len(lines)*svgLineHeight
+	theme := svgThemes[sw.theme]
+	var b bytes.Buffer
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" width="%.1f" height="%d" viewBox="0 0 %.1f %d">`+"\n",
+		width, height, width, height)
+	fmt.Fprintf(&b, `<rect width="100%%" height="100%%" fill="%s"/>`+"\n", theme[0])
+	fmt.Fprintf(&b, `<g font-family="DejaVu Sans Mono, Menlo, Consolas, monospace" font-size="%d" fill="%s" xml:space="preserve">`+"\n",
+		svgFontSize, theme[1])
+	for i, l := range lines {
+		top := svgPadding + i*svgLineHeight
+		for _, s := range l {
+			if s.style.bg != "" {
+				fmt.Fprintf(&b, `<rect x="%.1f" y="%d" width="%.1f" height="%d" fill="%s"/>`+"\n",
+					svgPadding+float64(s.col)*svgCharWidth, top,
+					float64(visibleWidth(s.text))*svgCharWidth, svgLineHeight, s.style.bg)
+			}
+		}
+		if len(l) == 0 {
+			continue
+		}
+		fmt.Fprintf(&b, `<text x="%d" y="%d">`, svgPadding, top+svgLineHeight-4)
+		for _, s := range l {
+			fmt.Fprintf(&b, `<tspan x="%.1f"%s>%s</tspan>`,
+				svgPadding+float64(s.col)*svgCharWidth, s.style.svgAttrs(), html.EscapeString(s.text))
+		}
+		b.WriteString("</text>\n")
+	}
+	b.WriteString("</g>\n</svg>\n")
+	_, err := sw.w.Write(b.Bytes())
+	return err
+}
+
+// svgAttrs returns the presentation attributes of the style for a tspan.
+func (s htmlStyle) svgAttrs() string {
+	var b strings.Builder
+	if s.fg != "" {
+		fmt.Fprintf(&b, ` fill="%s"`, s.fg)
+	}
+	if s.bold {
+		b.WriteString(` font-weight="bold"`)
+	}
+	if s.dim {
+		b.WriteString(` fill-opacity="0.6"`)
+	}
+	if s.italic {
+		b.WriteString(` font-style="italic"`)
+	}
+	if s.underline {
+		b.WriteString(` text-decoration="underline"`)
+	}
+	return b.String()
+}
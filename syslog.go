@@ -0,0 +1,114 @@
+// Copyright 2018 Andrew Werner, All Rights Reserved.
+
+package main
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"regexp"
+	"time"
+)
+
+// syslogFragmentTimeout is how long to wait for more fragments of a message
+// before it is taken to be complete.
+const syslogFragmentTimeout = 100 * time.Millisecond
+
+// syslogPriority matches the priority which begins every syslog message.
+var syslogPriority = regexp.MustCompile(`^<\d{1,3}>`)
+
+// NewSyslogUDPReader listens for syslog messages sent to the UDP address addr
+// and returns a reader of the messages, each on a line of its own.
+//
+// Messages split across several datagrams are reassembled. A datagram from a
+// sender which does not begin with a priority continues the last message from
+// that sender, which is complete once its next message begins or no datagram
+// has arrived from it for syslogFragmentTimeout. Fragments carry no sequence
+// numbers, so those which arrive out of order are not reordered, and repeated
+// datagrams are not dropped, as syslog legitimately repeats identical lines;
+// rather than guess, a continuation without a message to continue is passed
+// through as a message of its own.
+func NewSyslogUDPReader(addr string) (io.Reader, error) {
+	conn, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	pr, pw := io.Pipe()
+	go func() {
+		defer conn.Close()
+		pw.CloseWithError(reassembleSyslog(conn, pw))
+	}()
+	return pr, nil
+}
+
+// syslogSender is the state of the reassembly of the messages of one sender.
+type syslogSender struct {
+	pending []byte
+	seen    time.Time
+}
+
+// reassembleSyslog reads datagrams from conn and writes the messages they
+// make up to w.
+func reassembleSyslog(conn net.PacketConn, w io.Writer) error {
+	senders := map[string]*syslogSender{}
+	write := func(s *syslogSender) error {
+		_, err := w.Write(append(s.pending, '\n'))
+		s.pending = nil
+		return err
+	}
+	buf := make([]byte, 64<<10)
+	for {
+		if err := conn.SetReadDeadline(time.Now().Add(syslogFragmentTimeout)); err != nil {
+			return err
+		}
+		n, from, err := conn.ReadFrom(buf)
+		now := time.Now()
+		if err != nil {
+			if ne, ok := err.(net.Error); !ok || !ne.Timeout() {
+				return err
+			}
+		} else if err := receiveSyslog(senders, from.String(), buf[:n], now, write); err != nil {
+			return err
+		}
+		for k, s := range senders {
+			if now.Sub(s.seen) < syslogFragmentTimeout {
+				continue
+			}
+			if s.pending != nil {
+				if err := write(s); err != nil {
+					return err
+				}
+			}
+			delete(senders, k)
+		}
+	}
+}
+
+// receiveSyslog adds the datagram d from the sender from to the message it
+// begins or continues, writing the message it completes, if any.
+func receiveSyslog(
+	senders map[string]*syslogSender,
+	from string,
+	d []byte,
+	now time.Time,
+	write func(*syslogSender) error,
+) error {
+	d = bytes.TrimRight(d, "\r\n\x00")
+	s, ok := senders[from]
+	if !ok {
+		s = &syslogSender{}
+		senders[from] = s
+	}
+	s.seen = now
+	if s.pending != nil && !syslogPriority.Match(d) {
+		s.pending = append(s.pending, d...)
+		return nil
+	}
+	if s.pending != nil {
+		if err := write(s); err != nil {
+			return err
+		}
+	}
+	s.pending = append([]byte(nil), d...)
+	return nil
+}
@@ -0,0 +1,55 @@
+// Copyright 2018 Andrew Werner, All Rights Reserved.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// errStopped is returned when processing stops because of a signal.
+var errStopped = errors.New("stopped")
+
+// notifyStop returns a channel which is closed when the process receives an
+// interrupt or termination signal, or when maxRuntime has elapsed if it is
+// positive, so that processing can stop and the output be flushed. If that has
+// not finished within timeout, or another signal is received, the process
+// exits.
+func notifyStop(timeout, maxRuntime time.Duration) <-chan struct{} {
+	stop := make(chan struct{})
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	var expired <-chan time.Time
+	if maxRuntime > 0 {
+		expired = time.After(maxRuntime)
+	}
+	go func() {
+		select {
+		case <-sig:
+		case <-expired:
+		}
+		close(stop)
+		select {
+		case <-sig:
+		case <-time.After(timeout):
+			fmt.Fprintf(os.Stderr, "logcolor: teardown did not finish within %v\n", timeout)
+		}
+		restoreTerminal()
+		os.Exit(1)
+	}()
+	return stop
+}
+
+// stopped returns true if stop has been closed.
+func stopped(stop <-chan struct{}) bool {
+	select {
+	case <-stop:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,15 @@
+// Copyright 2018 Andrew Werner, All Rights Reserved.
+
+package main
+
+import (
+	"os"
+
+	"golang.org/x/term"
+)
+
+// isTerminal returns true if f is a terminal. Other character devices, such
+// as /dev/null, are not.
+func isTerminal(f *os.File) bool {
+	return term.IsTerminal(int(f.Fd()))
+}
@@ -0,0 +1,17 @@
+// Copyright 2018 Andrew Werner, All Rights Reserved.
+
+package main
+
+import "strings"
+
+// testEntryFlag holds the sample lines given by -test-entry.
+type testEntryFlag []string
+
+func (f *testEntryFlag) String() string {
+	return strings.Join(*f, "\n")
+}
+
+func (f *testEntryFlag) Set(s string) error {
+	*f = append(*f, s)
+	return nil
+}
@@ -0,0 +1,88 @@
+// Copyright 2018 Andrew Werner, All Rights Reserved.
+
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// boundLayouts are the layouts accepted by -since and -until in addition to
+// -time-layout. Those without a date are times of day.
+var boundLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02",
+	"15:04:05.999999999",
+	"15:04",
+}
+
+// timeBound is a bound of a timeWindow. If clock is set, it is a time of day
+// which is compared with the time of day of entries on any date.
+type timeBound struct {
+	t     time.Time
+	clock bool
+}
+
+// parseTimeBound parses the value of -since or -until with layout, if given,
+// or any of boundLayouts.
+func parseTimeBound(s, layout string) (*timeBound, error) {
+	layouts := boundLayouts
+	if layout != "" {
+		layouts = append([]string{layout}, layouts...)
+	}
+	for _, l := range layouts {
+		if t, err := time.Parse(l, s); err == nil {
+			return &timeBound{t: t, clock: t.Year() == 0}, nil
+		}
+	}
+	return nil, fmt.Errorf("cannot parse time %q", s)
+}
+
+// compare returns -1, 0 or 1 as t is before, equal to or after the bound.
+func (b *timeBound) compare(t time.Time) int {
+	bt := b.t
+	if b.clock {
+		t, bt = clockTime(t), clockTime(bt)
+	}
+	switch {
+	case t.Before(bt):
+		return -1
+	case t.After(bt):
+		return 1
+	}
+	return 0
+}
+
+// clockTime returns the time of day of t on a fixed date.
+func clockTime(t time.Time) time.Time {
+	return time.Date(0, 1, 1, t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), time.UTC)
+}
+
+// timeWindow is the range of times of the entries which are kept by -since
+// and -until.
+type timeWindow struct {
+	since, until *timeBound
+	// layout is that of the timestamps of entries, or empty to accept any of
+	// timestampLayouts.
+	layout string
+	// strict causes entries whose timestamps cannot be parsed to be skipped
+	// rather than kept.
+	strict bool
+}
+
+// contains returns true if the entry with the timestamp ts is to be kept.
+func (w *timeWindow) contains(ts string) bool {
+	t, ok := parseTimestamp(ts)
+	if w.layout != "" {
+		var err error
+		t, err = time.Parse(w.layout, ts)
+		ok = err == nil
+	}
+	if !ok {
+		return !w.strict
+	}
+	return (w.since == nil || w.since.compare(t) >= 0) &&
+		(w.until == nil || w.until.compare(t) <= 0)
+}
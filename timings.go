@@ -0,0 +1,71 @@
+// Copyright 2018 Andrew Werner, All Rights Reserved.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"time"
+)
+
+// stage identifies a section of the processing loop measured by timings.
+type stage int
+
+const (
+	decodeStage stage = iota
+	colorStage
+	templateStage
+	numStages
+)
+
+var stageNames = [numStages]string{
+	decodeStage:   "decode",
+	colorStage:    "color",
+	templateStage: "template",
+}
+
+// timings accumulates the time spent in each stage of processing for
+// -self-timing. All of the methods are no-ops on a nil *timings so that the
+// hot loop pays next to nothing when timing is disabled.
+type timings struct {
+	start   time.Time
+	entries int
+	stages  [numStages]time.Duration
+}
+
+func newTimings() *timings {
+	return &timings{start: time.Now()}
+}
+
+// track adds the time elapsed since start to s. It may be deferred as in
+// `defer t.track(colorStage, time.Now())`.
+func (t *timings) track(s stage, start time.Time) {
+	if t == nil {
+		return
+	}
+	t.stages[s] += time.Since(start)
+}
+
+func (t *timings) countEntry() {
+	if t == nil {
+		return
+	}
+	t.entries++
+}
+
+// report writes a summary of the accumulated timings to w. Decoding time
+// includes time spent waiting for input and templating time includes the time
+// spent looking up colors from within the template.
+func (t *timings) report(w io.Writer) {
+	if t == nil {
+		return
+	}
+	fmt.Fprintf(w, "logcolor: %d entries in %v\n", t.entries, time.Since(t.start))
+	for s, d := range t.stages {
+		var avg time.Duration
+		if t.entries > 0 {
+			avg = d / time.Duration(t.entries)
+		}
+		fmt.Fprintf(w, "  %-8s %12v total %10v/entry\n", stageNames[s], d, avg)
+	}
+}
@@ -0,0 +1,42 @@
+// Copyright 2018 Andrew Werner, All Rights Reserved.
+
+package main
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestColorIsTimed(t *testing.T) {
+	st := newTimings()
+	le := LogEntry{
+		Pattern:       testGlogPattern,
+		colors:        newColorMap(),
+		severityGroup: "severity",
+		levelOf:       parseLevel,
+		subexpNames:   map[string][]int{},
+		timings:       st,
+	}
+	d := NewEntryDecoder(testGlogPattern, strings.NewReader("n1> I181015 10:00:00.000001 1 foo.go:12 hello\n"))
+	if err := d.Decode(&le.Entry); err != nil {
+		t.Fatal(err)
+	}
+	le.Color()
+	if st.stages[colorStage] == 0 {
+		t.Error("no time was recorded for the color stage")
+	}
+}
+
+// TestSelfTimingColorStage checks that the colors looked up by the default
+// template, which uses .Color, are counted in the color stage.
+func TestSelfTimingColorStage(t *testing.T) {
+	_, stderr := runMainOutput(t, nil, readFixture(t, "glog.log"), "-self-timing", "-color", "always")
+	m := regexp.MustCompile(`(?m)^  color +(\S+) total`).FindStringSubmatch(stderr)
+	if m == nil {
+		t.Fatalf("no color stage in the report:\n%s", stderr)
+	}
+	if m[1] == "0s" {
+		t.Errorf("color stage is zero:\n%s", stderr)
+	}
+}
@@ -0,0 +1,166 @@
+// Copyright 2018 Andrew Werner, All Rights Reserved.
+
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// timestampLayouts are the layouts of the timestamps of common log formats,
+// including those of the presets.
+var timestampLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05.999999999",
+	"060102 15:04:05.999999",
+	"02/Jan/2006:15:04:05 -0700",
+	"Jan _2 15:04:05.999999",
+}
+
+// parseTimestamp parses a timestamp in any of timestampLayouts.
+func parseTimestamp(s string) (time.Time, bool) {
+	for _, layout := range timestampLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// spanPhases maps the values of the phase group to the phases of the events
+// which begin and end spans.
+var spanPhases = map[string]string{
+	"begin": "B",
+	"start": "B",
+	"b":     "B",
+	"end":   "E",
+	"stop":  "E",
+	"e":     "E",
+}
+
+// parseEventDuration parses a duration such as 3.4ms, or a number which is
+// taken to be milliseconds.
+func parseEventDuration(s string) (time.Duration, bool) {
+	if d, err := time.ParseDuration(s); err == nil {
+		return d, true
+	}
+	ms, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, false
+	}
+	return time.Duration(ms * float64(time.Millisecond)), true
+}
+
+// traceEventWriter writes entries as events in the Chrome Trace Event Format,
+// which can be loaded by chrome://tracing and Perfetto. Entries with a
+// duration become complete events, entries marked as the beginning or end of a
+// span become begin and end events and others instant events, each on a track
+// named by its color key. Entries without a timestamp are skipped. The events
+// are written as a JSON array which is left unterminated, as the format
+// permits, so that the output is valid however the input ends.
+type traceEventWriter struct {
+	w             io.Writer
+	timeGroup     string
+	durationGroup string
+	phaseGroup    string
+	tracks        map[string]int
+	started       bool
+}
+
+type traceEvent struct {
+	Name  string            `json:"name"`
+	Cat   string            `json:"cat,omitempty"`
+	Phase string            `json:"ph"`
+	TS    float64           `json:"ts"`
+	Dur   float64           `json:"dur,omitempty"`
+	Scope string            `json:"s,omitempty"`
+	PID   int               `json:"pid"`
+	TID   int               `json:"tid"`
+	Args  map[string]string `json:"args,omitempty"`
+}
+
+func newTraceEventWriter(w io.Writer, timeGroup, durationGroup, phaseGroup string) *traceEventWriter {
+	return &traceEventWriter{
+		w:             w,
+		timeGroup:     timeGroup,
+		durationGroup: durationGroup,
+		phaseGroup:    phaseGroup,
+		tracks:        map[string]int{},
+	}
+}
+
+func (tw *traceEventWriter) write(le *LogEntry) error {
+	if le.Header == "" {
+		return nil
+	}
+	ts, _ := le.Match(tw.timeGroup)
+	t, ok := parseTimestamp(ts)
+	if !ok {
+		return nil
+	}
+	key := strings.TrimSpace(le.ColorKey())
+	tid, ok := tw.tracks[key]
+	if !ok {
+		tid = len(tw.tracks) + 1
+		tw.tracks[key] = tid
+		if err := tw.emit(traceEvent{
+			Name: "thread_name", Phase: "M", PID: 1, TID: tid,
+			Args: map[string]string{"name": key},
+		}); err != nil {
+			return err
+		}
+	}
+	name := strings.TrimSpace(firstLine(le.Message))
+	if le.fields != nil {
+		// The message of an entry of fields is the newline which ends it.
+		name = le.Field("msg")
+		if name == "" {
+			name = le.Field("message")
+		}
+	}
+	if name == "" {
+		name = le.Header
+	}
+	ev := traceEvent{
+		Name:  name,
+		Cat:   key,
+		Phase: "i",
+		Scope: "t",
+		TS:    float64(t.UnixNano() / int64(time.Microsecond)),
+		PID:   1,
+		TID:   tid,
+	}
+	if s, _ := le.Match(tw.durationGroup); s != "" {
+		if d, ok := parseEventDuration(s); ok {
+			ev.Phase, ev.Scope, ev.Dur = "X", "", float64(d)/float64(time.Microsecond)
+		}
+	} else if s, _ := le.Match(tw.phaseGroup); s != "" {
+		if phase, ok := spanPhases[strings.ToLower(s)]; ok {
+			ev.Phase, ev.Scope = phase, ""
+		}
+	}
+	return tw.emit(ev)
+}
+
+func (tw *traceEventWriter) emit(ev traceEvent) error {
+	sep := ",\n"
+	if !tw.started {
+		sep, tw.started = "[\n", true
+	}
+	if _, err := io.WriteString(tw.w, sep); err != nil {
+		return err
+	}
+	b, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	_, err = tw.w.Write(b)
+	return err
+}
+
+func (tw *traceEventWriter) flush() error {
+	return nil
+}
@@ -0,0 +1,40 @@
+// Copyright 2018 Andrew Werner, All Rights Reserved.
+
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestTraceEventPhases(t *testing.T) {
+	in := `{"time":"2024-03-05T17:21:09Z","prefix":"api","msg":"request","phase":"begin"}
+{"time":"2024-03-05T17:21:09.25Z","prefix":"db","msg":"query","duration":"12ms"}
+{"time":"2024-03-05T17:21:09.5Z","prefix":"api","msg":"request","phase":"end"}
+{"time":"2024-03-05T17:21:10Z","prefix":"api","msg":"tick"}
+{"prefix":"api","msg":"no timestamp"}
+`
+	out := runMain(t, in, "-input-format", "json", "-output-format", "trace-event")
+	var events []traceEvent
+	// The array is left unterminated.
+	if err := json.Unmarshal([]byte(strings.TrimSpace(out)+"]"), &events); err != nil {
+		t.Fatalf("%v:\n%s", err, out)
+	}
+	var got []string
+	for _, ev := range events {
+		if ev.Phase != "M" {
+			got = append(got, ev.Phase+" "+ev.Name)
+		}
+	}
+	exp := []string{"B request", "X query", "E request", "i tick"}
+	if strings.Join(got, ", ") != strings.Join(exp, ", ") {
+		t.Fatalf("got events %q, expected %q", got, exp)
+	}
+	if events[1].TID != events[5].TID || events[1].TID == events[3].TID {
+		t.Errorf("events were not placed on a track for each color key: %+v", events)
+	}
+	if events[3].Dur != 12000 {
+		t.Errorf("duration %v, expected 12000µs", events[3].Dur)
+	}
+}
@@ -0,0 +1,50 @@
+// Copyright 2018 Andrew Werner, All Rights Reserved.
+
+package main
+
+import (
+	"io"
+	"os"
+	"time"
+)
+
+// clearScreen moves the cursor to the top left of the terminal and clears it.
+const clearScreen = "\x1b[H\x1b[2J"
+
+// watchFile calls process with the contents of the file at path, and again
+// each time the size or modification time of the file changes, clearing the
+// terminal before each call. Changes are detected by polling the file every
+// pollInterval. It returns when stop is closed or if the file cannot be read
+// or process fails.
+func watchFile(
+	path string, pollInterval time.Duration, stop <-chan struct{}, process func(io.Reader) error,
+) error {
+	var last os.FileInfo
+	for {
+		fi, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		if last == nil || fi.Size() != last.Size() || !fi.ModTime().Equal(last.ModTime()) {
+			f, err := os.Open(path)
+			if err != nil {
+				return err
+			}
+			if _, err := io.WriteString(os.Stdout, clearScreen); err != nil {
+				f.Close()
+				return err
+			}
+			err = process(f)
+			f.Close()
+			if err != nil {
+				return err
+			}
+			last = fi
+		}
+		select {
+		case <-stop:
+			return nil
+		case <-time.After(pollInterval):
+		}
+	}
+}